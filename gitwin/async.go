@@ -0,0 +1,243 @@
+// running slow git commands (fetch, pull, push...) in the background so the
+// window stays responsive, with Kill to interrupt them
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"reflect"
+	"runtime/debug"
+	"strings"
+	"time"
+
+	"9fans.net/go/acme"
+)
+
+const mainTag = "Get Diff Fetch Pull Branches Push Ls Log Help"
+
+// writes straight to the window body, for streaming output
+type bodyWriter struct {
+	w *acme.Win
+}
+
+func (b bodyWriter) Write(p []byte) (int, error) {
+	return b.w.Write("body", p)
+}
+
+// the command running in the background, empty if there isn't one
+func (h *handler) busy() string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.running
+}
+
+// whether the window is showing a background command's output, which
+// refreshes leave alone
+func (h *handler) showingOutput() bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.output
+}
+
+// let the watcher redraw the window again, once the user has moved on from
+// a background command's output
+func (h *handler) showingStatus() {
+	h.mu.Lock()
+	h.output = false
+	h.mu.Unlock()
+}
+
+// run f with the window to itself, see handler.winMu
+func (h *handler) exclusive(f func()) {
+	h.winMu.Lock()
+	defer h.winMu.Unlock()
+	f()
+}
+
+// run a command from a child window that acts on the repo, which gets the
+// same treatment as the +git window's own commands: rejected while a
+// background command is running, and taking its turn with the window
+func (h *handler) command(f func() error) error {
+	h.winMu.Lock()
+	defer h.winMu.Unlock()
+	if running := h.busy(); running != "" {
+		return fmt.Errorf("busy running %s, Kill it first", running)
+	}
+	h.showingStatus()
+	return f()
+}
+
+// run git in the background, streaming its output into the window after
+// whatever is already in h.buf, then call done once it's finished
+func (h *handler) gitAsync(done func(error), args ...string) error {
+	return h.gitAsyncEnv(nil, done, args...)
+}
+
+// like gitAsync, with extra environment variables for git
+func (h *handler) gitAsyncEnv(env []string, done func(error), args ...string) error {
+	// stderr is kept too, to spot a locked index as execGit does
+	var stderr bytes.Buffer
+	run := func(ctx context.Context) error {
+		cmd := exec.CommandContext(ctx, "git", args...)
+		cmd.Dir = h.path
+		if env != nil {
+			cmd.Env = append(os.Environ(), env...)
+		}
+		cmd.Stdout = bodyWriter{h.w}
+		cmd.Stderr = io.MultiWriter(bodyWriter{h.w}, &stderr)
+		// interrupt rather than kill so git can clean up its lock files,
+		// and stop waiting on the output if e.g. ssh is holding it open
+		cmd.Cancel = func() error { return cmd.Process.Signal(os.Interrupt) }
+		cmd.WaitDelay = 5 * time.Second
+		debugf("running in background: %v", cmd)
+		return cmd.Run()
+	}
+	desc := "git " + strings.Join(args, " ")
+	return h.background(desc, func(ctx context.Context) error {
+		err := run(ctx)
+		for attempt := 0; err != nil && ctx.Err() == nil && attempt < lockRetries &&
+			strings.Contains(stderr.String(), "index.lock"); attempt++ {
+			debugf("index locked for %s, retrying", desc)
+			time.Sleep(lockWait)
+			stderr.Reset()
+			err = run(ctx)
+		}
+		return err
+	}, done)
+}
+
+// run f in the background with Kill in the tag to cancel its context, then
+// write how it went into the window after anything it streamed there and
+// call done, the window is busy until done returns
+func (h *handler) background(desc string, f func(ctx context.Context) error, done func(error)) error {
+	h.mu.Lock()
+	if h.running != "" {
+		h.mu.Unlock()
+		return fmt.Errorf("busy running %s, Kill it first", h.running)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	h.running, h.cancel = desc, cancel
+	h.output = true
+	h.mu.Unlock()
+
+	h.w.Ctl("cleartag")
+	h.w.Write("tag", []byte(" Kill (running "+desc+")"))
+	fmt.Fprintf(&h.buf, "%s\n", desc)
+	h.flush()
+
+	go func() {
+		err := f(ctx)
+		h.winMu.Lock()
+		defer h.winMu.Unlock()
+		switch {
+		case err != nil && ctx.Err() != nil:
+			err = errors.New("killed")
+			fmt.Fprintf(&h.buf, "%s: killed\n", desc)
+		case err != nil:
+			fmt.Fprintf(&h.buf, "%s: %v\n", desc, err)
+		default:
+			fmt.Fprintf(&h.buf, "%s: done\n", desc)
+		}
+		cancel()
+		h.w.Write("body", h.buf.Bytes())
+		h.w.Ctl("clean")
+		h.buf.Reset()
+		// still busy until done has finished, so nothing else starts on
+		// top of whatever it does next
+		if done != nil {
+			done(err)
+		}
+		h.w.Ctl("cleartag")
+		h.w.Write("tag", []byte(" "+mainTag))
+		h.mu.Lock()
+		h.running, h.cancel = "", nil
+		h.mu.Unlock()
+	}()
+	return nil
+}
+
+// interrupt the command running in the background
+func (h *handler) ExecKill(cmd string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.cancel != nil {
+		h.cancel()
+	}
+}
+
+// the same dispatch as acme's EventLoop, except that commands for this
+// window are rejected while a background command is running, apart from Kill
+func (h *handler) eventLoop() {
+	for e := range h.w.EventChan() {
+		switch e.C2 {
+		case 'x', 'X':
+			cmd := strings.TrimSpace(string(e.Text))
+			verb, arg := cmd, ""
+			if i := strings.IndexAny(verb, " \t"); i >= 0 {
+				verb, arg = verb[:i], strings.TrimSpace(verb[i+1:])
+			}
+			m := reflect.ValueOf(h).MethodByName("Exec" + verb)
+			if !m.IsValid() {
+				if !h.Execute(cmd) {
+					h.w.WriteEvent(e)
+				}
+				continue
+			}
+			h.exclusive(func() {
+				if running := h.busy(); running != "" && verb != "Kill" {
+					h.w.Errf("busy running %s, Kill it first", running)
+					return
+				}
+				if verb != "Kill" {
+					h.showingStatus()
+				}
+				h.call(m, cmd, arg)
+			})
+		case 'l', 'L':
+			if len(e.Text) == 0 && e.Q0 < e.Q1 {
+				h.w.Addr("#%d,#%d", e.Q0, e.Q1)
+				data, err := h.w.ReadAll("xdata")
+				if err != nil {
+					h.w.Err(err.Error())
+				}
+				e.Text = data
+			}
+			var looked bool
+			h.exclusive(func() { looked = h.Look(string(e.Text)) })
+			if !looked {
+				h.w.WriteEvent(e)
+			}
+		}
+	}
+}
+
+// call an Exec method, which takes either no arguments or the argument
+// string, and returns either nothing or an error
+func (h *handler) call(m reflect.Value, cmd, arg string) {
+	t := m.Type()
+	var args []reflect.Value
+	switch {
+	case t.NumIn() == 1 && t.In(0).Kind() == reflect.String:
+		args = append(args, reflect.ValueOf(arg))
+	case t.NumIn() == 0 && arg == "":
+	default:
+		h.w.Errf("bad arguments for %s", cmd)
+		return
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			h.w.Errf("gitwin: panic running %s: %v\n%s", cmd, r, debug.Stack())
+		}
+	}()
+	out := m.Call(args)
+	if len(out) == 1 {
+		if err, _ := out[0].Interface().(error); err != nil {
+			h.w.Errf("%v", err)
+		}
+	}
+}
@@ -0,0 +1,188 @@
+// +blame windows, condensed from `git blame --porcelain`
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"9fans.net/go/acme"
+)
+
+type blameCommit struct {
+	author string
+	date   string
+}
+
+type blameLine struct {
+	hash string
+	line int // line number in the final file
+	text string
+}
+
+// parse `git blame --porcelain` output into one entry per line of the file
+func parseBlame(out []byte) ([]blameLine, map[string]*blameCommit, error) {
+	commits := map[string]*blameCommit{}
+	var lines []blameLine
+	var cur *blameLine
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	scanner.Buffer(nil, 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if cur == nil {
+			// <hash> <orig line> <final line> [<lines in group>]
+			f := strings.Fields(line)
+			if len(f) < 3 {
+				return nil, nil, fmt.Errorf("bad blame header: %q", line)
+			}
+			n, err := strconv.Atoi(f[2])
+			if err != nil {
+				return nil, nil, fmt.Errorf("bad blame header: %q", line)
+			}
+			cur = &blameLine{hash: f[0], line: n}
+			if commits[cur.hash] == nil {
+				commits[cur.hash] = &blameCommit{}
+			}
+			continue
+		}
+		if text, ok := strings.CutPrefix(line, "\t"); ok {
+			cur.text = text
+			lines = append(lines, *cur)
+			cur = nil
+			continue
+		}
+		c := commits[cur.hash]
+		key, val, _ := strings.Cut(line, " ")
+		switch key {
+		case "author":
+			c.author = val
+		case "author-time":
+			if t, err := strconv.ParseInt(val, 10, 64); err == nil {
+				c.date = time.Unix(t, 0).Format("2006-01-02")
+			}
+		}
+	}
+	return lines, commits, scanner.Err()
+}
+
+// state for a +blame window
+type blameWin struct {
+	*childWin
+	file string
+}
+
+// Blame path opens a +blame window for a file in the repo
+func (h *handler) ExecBlame(cmd string) error {
+	file := strings.TrimSpace(cmd)
+	if file == "" {
+		return errors.New("usage: Blame path")
+	}
+	c, err := h.newChild("+blame/"+file, "Get Sync ")
+	if err != nil {
+		return err
+	}
+	bw := &blameWin{childWin: c, file: file}
+	go func() {
+		bw.ExecGet("")
+		bw.ExecSync("")
+		runEvents(c.w, bw)
+	}()
+	return nil
+}
+
+func (bw *blameWin) ExecGet(cmd string) {
+	out, err := gitOutput(bw.repo.path, "blame", "--porcelain", "--", bw.file)
+	if err != nil {
+		fmt.Fprintln(&bw.buf, err)
+		bw.flush()
+		return
+	}
+	lines, commits, err := parseBlame(out)
+	if err != nil {
+		fmt.Fprintf(&bw.buf, "error parsing blame for %s: %v\n", bw.file, err)
+		bw.flush()
+		return
+	}
+	// one line per line of the file, so line numbers match up for Sync
+	for _, l := range lines {
+		c := commits[l.hash]
+		hash := l.hash[:8]
+		if strings.Trim(l.hash, "0") == "" {
+			hash = "--------" // not committed yet
+		}
+		author := c.author
+		// cut on a rune boundary, the padding counts runes too
+		if utf8.RuneCountInString(author) > 16 {
+			author = string([]rune(author)[:16])
+		}
+		fmt.Fprintf(&bw.buf, "%s %-16s %s %5d| %s\n", hash, author, c.date, l.line, l.text)
+	}
+	bw.flush()
+}
+
+func (bw *blameWin) Look(arg string) bool {
+	return bw.repo.lookCommit(arg)
+}
+
+// select the blame line for the current line in the file's own window
+func (bw *blameWin) ExecSync(cmd string) {
+	line, err := currentLine(filepath.Join(bw.repo.path, bw.file))
+	if err != nil {
+		debugf("no current line for %s: %v", bw.file, err)
+		return
+	}
+	bw.w.Addr("%d", line)
+	bw.w.Ctl("dot=addr")
+	bw.w.Ctl("show")
+}
+
+// find the line number of dot in the acme window for path,
+// the same way acmelinenum does
+func currentLine(path string) (int, error) {
+	wins, err := acme.Windows()
+	if err != nil {
+		return 0, err
+	}
+	for _, wi := range wins {
+		if wi.Name != path {
+			continue
+		}
+		w, err := acme.Open(wi.ID, nil)
+		if err != nil {
+			return 0, err
+		}
+		defer w.CloseFiles()
+		// reading addr first makes sure the addr file is open before setting it
+		if _, _, err := w.ReadAddr(); err != nil {
+			return 0, err
+		}
+		if err := w.Ctl("addr=dot"); err != nil {
+			return 0, err
+		}
+		q0, _, err := w.ReadAddr()
+		if err != nil {
+			return 0, err
+		}
+		body, err := w.ReadAll("body")
+		if err != nil {
+			return 0, err
+		}
+		// q0 counts runes, not bytes
+		line := 1
+		for i := 0; i < q0 && len(body) > 0; i++ {
+			r, n := utf8.DecodeRune(body)
+			if r == '\n' {
+				line++
+			}
+			body = body[n:]
+		}
+		return line, nil
+	}
+	return 0, fmt.Errorf("no window open for %s", path)
+}
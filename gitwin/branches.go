@@ -0,0 +1,243 @@
+// the +branches window and checking out branches
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+type branch struct {
+	name     string // short name, e.g. main or origin/main
+	remote   bool
+	upstream string
+	track    string // e.g. "[ahead 1, behind 2]" or "[gone]"
+	date     string // of the last commit
+	hash     string
+	head     bool // currently checked out
+}
+
+// list local and remote branches
+func (h *handler) branches() ([]branch, error) {
+	return h.backend.Branches()
+}
+
+func (h *handler) hasRef(ref string) bool {
+	_, err := gitOutput(h.path, "show-ref", "--verify", "--quiet", ref)
+	return err == nil
+}
+
+// work out how to check out name: an existing local branch, a local branch
+// for a remote one, or else a new branch from HEAD
+func (h *handler) checkoutArgs(name string) []string {
+	if h.hasRef("refs/heads/" + name) {
+		return []string{"checkout", name}
+	}
+	if h.hasRef("refs/remotes/" + name) {
+		_, local, _ := strings.Cut(name, "/")
+		if h.hasRef("refs/heads/" + local) {
+			return []string{"checkout", local}
+		}
+		return []string{"checkout", "-b", local, "--track", name}
+	}
+	return []string{"checkout", "-b", name}
+}
+
+func (h *handler) ExecCheckout(cmd string) error {
+	name := strings.TrimSpace(cmd)
+	if name == "" {
+		return errors.New("usage: Checkout branch")
+	}
+	debugf("doing ExecCheckout [%s]\n", name)
+	if h.git(h.checkoutArgs(name)...) != nil {
+		h.flush()
+	} else {
+		h.ExecGet("")
+	}
+	h.repoWindows("get")
+	h.checkConflicts()
+	return nil
+}
+
+// state for a +branches window
+type branchWin struct {
+	*childWin
+
+	// held while writing the body, which happens from the window's own
+	// events and when a RebaseOnto finishes in the background
+	mu sync.Mutex
+}
+
+func (h *handler) ExecBranches(cmd string) error {
+	c, err := h.newChild("+branches", "Get Prune ")
+	if err != nil {
+		return err
+	}
+	bw := &branchWin{childWin: c}
+	go func() {
+		bw.ExecGet("")
+		runEvents(c.w, bw)
+	}()
+	return nil
+}
+
+func (bw *branchWin) ExecGet(cmd string) {
+	bw.mu.Lock()
+	defer bw.mu.Unlock()
+	bs, err := bw.repo.branches()
+	if err != nil {
+		fmt.Fprintln(&bw.buf, err)
+		bw.flush()
+		return
+	}
+	var local, remote bytes.Buffer
+	for _, b := range bs {
+		cur := " "
+		if b.head {
+			cur = "*"
+		}
+		if b.remote {
+			fmt.Fprintf(&remote, "%s\t%s\t%s\n", b.name, b.date, b.hash)
+			fmt.Fprintf(&remote, "\tCheckout %s\tMerge %s\tRebaseOnto %s\n", b.name, b.name, b.name)
+			continue
+		}
+		up := b.upstream
+		if up == "" {
+			up = "no upstream"
+		}
+		fmt.Fprintf(&local, "%s %s\t%s %s\t%s\t%s\n", cur, b.name, up, b.track, b.date, b.hash)
+		fmt.Fprintf(&local, "\tCheckout %s\tDelete %s\tRename %s new_name\tMerge %s\tRebaseOnto %s\n", b.name, b.name, b.name, b.name, b.name)
+	}
+	fmt.Fprintf(&bw.buf, "LOCAL\n%sREMOTE\n%s", local.String(), remote.String())
+	bw.flush()
+}
+
+// run a git command for the repo, the output goes to the status window
+func (bw *branchWin) run(args ...string) error {
+	return bw.repo.command(func() error {
+		bw.repo.git(args...)
+		bw.repo.repoWindows("get")
+		bw.repo.ExecGet("")
+		bw.repo.checkConflicts()
+		bw.ExecGet("")
+		return nil
+	})
+}
+
+func (bw *branchWin) ExecCheckout(name string) error {
+	if name == "" {
+		return errors.New("usage: Checkout branch")
+	}
+	return bw.run(bw.repo.checkoutArgs(name)...)
+}
+
+// delete a local branch, refusing if it isn't merged
+func (bw *branchWin) ExecDelete(name string) error {
+	if name == "" {
+		return errors.New("usage: Delete branch")
+	}
+	return bw.run("branch", "-d", name)
+}
+
+// delete a local branch whether it's merged or not, for Prune's gone branches
+func (bw *branchWin) ExecForceDelete(name string) error {
+	if name == "" {
+		return errors.New("usage: ForceDelete branch")
+	}
+	return bw.run("branch", "-D", name)
+}
+
+func (bw *branchWin) ExecRename(cmd string) error {
+	f := strings.Fields(cmd)
+	if len(f) != 2 {
+		return errors.New("usage: Rename branch new_name")
+	}
+	return bw.run("branch", "-m", f[0], f[1])
+}
+
+func (bw *branchWin) ExecMerge(name string) error {
+	if name == "" {
+		return errors.New("usage: Merge branch")
+	}
+	return bw.run("merge", "--no-edit", name)
+}
+
+// rebase the current branch onto another, in the background in the status window
+func (bw *branchWin) ExecRebaseOnto(name string) error {
+	if name == "" {
+		return errors.New("usage: RebaseOnto branch")
+	}
+	return bw.repo.command(func() error {
+		return bw.repo.gitAsync(func(error) {
+			bw.repo.repoWindows("get")
+			bw.repo.checkConflicts()
+			bw.ExecGet("")
+		}, "rebase", name)
+	})
+}
+
+// a local branch Prune offers to delete
+type prunable struct {
+	name  string
+	why   string
+	force bool // not merged, so git branch -d would refuse it
+}
+
+// local branches that are merged into the main branch, or whose upstream is
+// gone. a gone branch was usually squashed or rebased in upstream, so git
+// doesn't see it as merged and it needs deleting with -D
+func (h *handler) prunable() (string, []prunable, error) {
+	bs, err := h.branches()
+	if err != nil {
+		return "", nil, err
+	}
+	mainName := h.getMainName()
+	merged := map[string]bool{}
+	if mainName != "" {
+		if out, err := gitOutput(h.path, "branch", "--merged", mainName, "--format=%(refname:short)"); err == nil {
+			for _, name := range strings.Fields(string(out)) {
+				merged[name] = true
+			}
+		}
+	}
+	var ps []prunable
+	for _, b := range bs {
+		if b.remote || b.head || b.name == mainName {
+			continue
+		}
+		switch {
+		case merged[b.name]:
+			ps = append(ps, prunable{name: b.name, why: "merged into " + mainName})
+		case b.track == "[gone]":
+			ps = append(ps, prunable{name: b.name, why: "upstream " + b.upstream + " is gone", force: true})
+		}
+	}
+	return mainName, ps, nil
+}
+
+// list local branches whose upstream is gone or that are merged into the main branch
+func (bw *branchWin) ExecPrune(cmd string) {
+	bw.mu.Lock()
+	defer bw.mu.Unlock()
+	mainName, ps, err := bw.repo.prunable()
+	if err != nil {
+		fmt.Fprintln(&bw.buf, err)
+		bw.flush()
+		return
+	}
+	fmt.Fprintf(&bw.buf, "PRUNABLE (upstream gone or merged into %s)\n", mainName)
+	for _, p := range ps {
+		del := "Delete"
+		if p.force {
+			del = "ForceDelete"
+		}
+		fmt.Fprintf(&bw.buf, "%s\t%s\n\t%s %s\n", p.name, p.why, del, p.name)
+	}
+	if len(ps) == 0 {
+		fmt.Fprintln(&bw.buf, "\tnothing to prune")
+	}
+	fmt.Fprintln(&bw.buf, "\nGet to list all branches again")
+	bw.flush()
+}
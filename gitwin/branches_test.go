@@ -0,0 +1,52 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestPrunable(t *testing.T) {
+	dir := testRepo(t)
+	commitFile(t, dir, "a.txt", "1")
+	mustGit(t, dir, "config", "remote.origin.url", "https://example.com/r.git")
+	mustGit(t, dir, "config", "remote.origin.fetch", "+refs/heads/*:refs/remotes/origin/*")
+	// squashed upstream and deleted there, so it's gone but not merged
+	mustGit(t, dir, "checkout", "-q", "-b", "squashed")
+	commitFile(t, dir, "b.txt", "1")
+	mustGit(t, dir, "config", "branch.squashed.remote", "origin")
+	mustGit(t, dir, "config", "branch.squashed.merge", "refs/heads/squashed")
+	// merged, with no upstream
+	mustGit(t, dir, "checkout", "-q", "-b", "merged", "main")
+	mustGit(t, dir, "checkout", "-q", "main")
+	// neither
+	mustGit(t, dir, "checkout", "-q", "-b", "wip")
+	commitFile(t, dir, "c.txt", "1")
+	mustGit(t, dir, "checkout", "-q", "main")
+
+	h := &handler{path: dir, backend: execRepo{dir: dir}}
+	mainName, ps, err := h.prunable()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []prunable{
+		{name: "merged", why: "merged into main"},
+		{name: "squashed", why: "upstream origin/squashed is gone", force: true},
+	}
+	if mainName != "main" || !reflect.DeepEqual(ps, want) {
+		t.Fatalf("prunable = %s %+v, want main %+v", mainName, ps, want)
+	}
+	if _, err := gitOutput(dir, "branch", "-d", "squashed"); err == nil {
+		t.Fatal("branch -d deleted the unmerged gone branch")
+	}
+	// what Delete and ForceDelete run
+	for _, p := range ps {
+		flag := "-d"
+		if p.force {
+			flag = "-D"
+		}
+		mustGit(t, dir, "branch", flag, p.name)
+	}
+	if _, ps, err = h.prunable(); err != nil || len(ps) != 0 {
+		t.Errorf("after pruning, prunable = %+v, %v", ps, err)
+	}
+}
@@ -1,11 +1,10 @@
 package main
 
 import (
-	"bufio"
-	"bytes"
+	"errors"
 	"fmt"
-	"log"
 	"os"
+	"path/filepath"
 	"reflect"
 	"slices"
 	"strings"
@@ -13,34 +12,16 @@ import (
 	"9fans.net/go/acme"
 )
 
-func (h *handler) getMainName() string {
-	h.git("branch", "-l")
-	branchWords := strings.Fields(h.buf.String())
-	h.buf = bytes.Buffer{}
-	debugf("branch output: %v", branchWords)
-	for _, w := range branchWords {
-		switch w {
-		case "main":
-			return "main"
-		case "master":
-			return "master"
-		}
-	}
-	return ""
-}
-
-func (h *handler) ExecTrackOrigin(cmd string) {
+func (h *handler) ExecTrackOrigin(cmd string) error {
 	status, err := h.gitPorcelain()
 	if err != nil {
-		log.Fatalf("error getting status: %v", err)
+		return err
 	}
-	switch status.branch {
-	case "master":
-	case "main":
-	default:
-		h.git("branch", "--set-upstream-to=origin/"+status.branch, status.branch)
+	if status.Branch.Head != h.getMainName() {
+		h.git("branch", "--set-upstream-to="+h.config().remote+"/"+status.Branch.Head, status.Branch.Head)
 	}
 	h.flush()
+	return nil
 }
 
 func (h *handler) ExecRemote(cmd string) {
@@ -59,7 +40,7 @@ func regularFile(p string) bool {
 func (h *handler) repoWindows(winCmd string) {
 	allWindows, _ := acme.Windows()
 	for _, w := range allWindows {
-		if strings.HasPrefix(w.Name, h.path) && regularFile(w.Name) {
+		if ownerOf(w.Name) == h && regularFile(w.Name) {
 			if win, err := acme.Open(w.ID, nil); win != nil && err == nil {
 				// see acme(4) for ctl commands here
 				debugf("doing '%s' on window %d: %s", winCmd, w.ID, w.Name)
@@ -78,12 +59,15 @@ func (h *handler) ExecRevert(cmd string) {
 	args := []string{"checkout", "--"}
 	files := slices.DeleteFunc(strings.Fields(cmd), func(w string) bool { return w == "Revert" })
 	args = append(args, files...)
-	h.git(args...)
+	if h.git(args...) != nil {
+		h.flush()
+		return
+	}
 
 	allWindows, _ := acme.Windows()
 	for _, filename := range files {
 		for _, w := range allWindows {
-			if strings.HasPrefix(w.Name, h.path) && strings.HasSuffix(w.Name, filename) {
+			if ownerOf(w.Name) == h && strings.HasSuffix(w.Name, filename) {
 				if win, err := acme.Open(w.ID, nil); win != nil && err == nil {
 					// see acme(4) for ctl commands here
 					win.Ctl("clean")
@@ -100,9 +84,8 @@ func (h *handler) ExecAdd(cmd string) {
 	words := strings.Fields(cmd)
 	files := slices.DeleteFunc(words, func(w string) bool { return w == "Add" })
 	debugf("command words: %v, files: %v", words, files)
-	args := []string{"add"}
-	args = append(args, files...)
-	if h.git(args...) != nil {
+	if err := h.backend.Add(files...); err != nil {
+		fmt.Fprintln(&h.buf, err)
 		h.flush()
 	} else {
 		h.ExecGet("")
@@ -120,136 +103,134 @@ func (h *handler) ExecUnstage(cmd string) {
 	}
 }
 
-func (h *handler) ExecBranches(cmd string) {
-	h.git("branch", "-a")
-	h.flush()
-}
+// the conflict actions take the rest of the line as a single path, which
+// can have spaces in it
 
-func (h *handler) ExecLs(cmd string) {
-	h.git("ls-files")
-	if cmd == "" {
-		var tmp bytes.Buffer
-		scanner := bufio.NewScanner(&h.buf)
-		for scanner.Scan() {
-			b := scanner.Bytes()
-			if strings.HasPrefix(string(b), "vendor/") {
-				continue
-			}
-			tmp.Write(b)
-			tmp.WriteString("\n")
-		}
-		h.buf = tmp
-	}
-	h.flush()
+// take our side of a conflicted file, the file still needs a Resolve afterwards
+func (h *handler) ExecOurs(cmd string) {
+	h.checkoutSide("--ours", strings.TrimSpace(cmd))
 }
 
-func (h *handler) ExecLsAll(cmd string) {
-	h.ExecLs("all")
+// take their side of a conflicted file, the file still needs a Resolve afterwards
+func (h *handler) ExecTheirs(cmd string) {
+	h.checkoutSide("--theirs", strings.TrimSpace(cmd))
 }
 
-func (h *handler) ExecCheckout(cmd string) {
-	debugf("doing ExecCheckout [%s]\n", cmd)
-	args := []string{"checkout"}
-	switch {
-	case cmd == "master" || cmd == "main":
-		args = append(args, cmd)
-
-	case strings.Contains(cmd, "/"): // checkout a branch that tracks a remote
-		split := strings.Split(cmd, "/")
-		args = append(args, "-b", split[len(split)-1], cmd)
-
-	default: // checkout a new local branch
-		args = append(args, "-B", cmd)
-	}
-	if h.git(args...) != nil {
+func (h *handler) checkoutSide(side, file string) {
+	if h.git("checkout", side, "--", file) != nil {
 		h.flush()
-	} else {
-		h.ExecGet("")
+		return
 	}
 	h.repoWindows("get")
+	h.ExecGet("")
 }
 
-func (h *handler) ExecCommit(cmd string) {
-	// check for an "all:" prefix on the commit message
-	args := []string{"commit"}
-	msg := cmd
-	if strings.HasPrefix(cmd, "all:") {
-		args = append(args, "-a")
-		msg = cmd[4:]
-	}
-	args = append(args, "-m", msg)
-	if h.git(args...) != nil {
+// mark a conflicted file as resolved
+func (h *handler) ExecResolve(cmd string) {
+	if h.git("add", "--", strings.TrimSpace(cmd)) != nil {
 		h.flush()
 	} else {
-		h.buf.WriteString("\n")
 		h.ExecGet("")
 	}
 }
 
-func (h *handler) ExecDiff(cmd string) {
-	h.git("diff")
+// open a file from the repo in acme
+func (h *handler) ExecOpen(cmd string) error {
+	f := strings.TrimSpace(cmd)
+	if _, err := openFile(filepath.Join(h.path, f)); err != nil {
+		return fmt.Errorf("error opening %s: %w", f, err)
+	}
+	return nil
+}
+
+// Ls lists the tracked files that pass the lsInclude and lsExclude filters
+func (h *handler) ExecLs(cmd string) {
+	files, err := h.lsFiles(cmd != "")
+	if err != nil {
+		fmt.Fprintln(&h.buf, err)
+	}
+	for _, f := range files {
+		fmt.Fprintln(&h.buf, f)
+	}
 	h.flush()
 }
 
-func (h *handler) ExecDifftool(cmd string) {
-	h.git("difftool", "-y")
-	h.ExecGet("")
+func (h *handler) ExecLsAll(cmd string) {
+	h.ExecLs("all")
 }
 
-func (h *handler) ExecMergetool(cmd string) {
-	h.git("mergetool", "-y")
-	h.ExecGet("")
+func (h *handler) ExecCommit(cmd string) {
+	// check for an "all:" prefix on the commit message
+	msg, all := strings.CutPrefix(cmd, "all:")
+	out, err := h.backend.Commit(msg, all)
+	if err != nil {
+		fmt.Fprintln(&h.buf, err)
+		h.flush()
+	} else {
+		h.buf.WriteString(out + "\n")
+		h.ExecGet("")
+	}
 }
 
-func (h *handler) ExecFetch(cmd string) {
-	h.git("fetch")
-	h.flush()
+func (h *handler) ExecDifftool(cmd string) error {
+	return h.gitAsync(func(error) { h.ExecGet("") }, "difftool", "-y")
 }
 
-func (h *handler) ExecLog(cmd string) {
-	if cmd == "" {
-		cmd = "-10"
-	}
-	h.git("log", cmd)
-	h.flush()
+func (h *handler) ExecMergetool(cmd string) error {
+	return h.gitAsync(func(error) { h.ExecGet("") }, "mergetool", "-y")
 }
 
-func (h *handler) ExecPull(cmd string) {
-	h.git("pull")
-	h.repoWindows("get")
-	h.flush()
+func (h *handler) ExecFetch(cmd string) error {
+	return h.gitAsync(nil, "fetch")
 }
 
-func (h *handler) ExecRebase(cmd string) {
+func (h *handler) ExecPull(cmd string) error {
+	return h.gitAsync(func(error) {
+		h.repoWindows("get")
+		h.checkConflicts()
+	}, "pull")
+}
+
+func (h *handler) ExecRebase(cmd string) error {
 	args := []string{"rebase"}
 	if cmd != "" {
 		args = append(args, cmd)
 	}
-	h.git(args...)
-	h.repoWindows("get")
-	h.flush()
+	return h.gitAsync(func(error) {
+		h.repoWindows("get")
+		h.checkConflicts()
+	}, args...)
 }
 
-func (h *handler) ExecPush(cmd string) {
+// Push [remote] pushes the current branch to the configured remote, or the
+// given one, following the repo's push policy (see config.go)
+func (h *handler) ExecPush(cmd string) error {
 	status, err := h.gitPorcelain()
 	if err != nil {
-		log.Fatalf("error getting status: %v", err)
+		return err
 	}
-	args := []string{"push", "origin"}
-	if len(cmd) > 0 {
-		// just push to origin directly ?
-	} else {
-		remote := status.branch
-		if status.branch == "master" || status.branch == "main" {
-			remote = tsbranch()
-			fmt.Fprintf(&h.buf, "pushing to remote branch %s instead of main/master\n", remote)
-		} else {
-			args = append(args, "--set-upstream")
-		}
-		args = append(args, status.branch+":"+remote)
+	cfg := h.config()
+	remote := cfg.remote
+	if cmd != "" {
+		remote = cmd
 	}
-	h.git(args...)
-	h.flush()
+	if status.Branch.Detached() {
+		return errors.New("HEAD is detached, check out a branch to push")
+	}
+	branch := status.Branch.Head
+	target := branch
+	args := []string{"push", remote}
+	switch {
+	case cfg.pushPolicy == pushProtected && branch == h.getMainName():
+		target = tsbranch()
+		fmt.Fprintf(&h.buf, "pushing to remote branch %s instead of %s\n", target, branch)
+	case cfg.pushPolicy == pushForceWithLease:
+		args = append(args, "--force-with-lease", "--set-upstream")
+	default:
+		args = append(args, "--set-upstream")
+	}
+	args = append(args, branch+":"+target)
+	return h.gitAsync(nil, args...)
 }
 
 func (h *handler) ExecGetWindows(cmd string) {
@@ -265,14 +246,27 @@ func (h *handler) ExecGet(cmd string) {
 	debugf("doing ExecGet [%s]\n", cmd)
 	status, err := h.gitPorcelain()
 	if err != nil {
-		log.Fatalf("error getting status: %v", err)
+		// keep whatever output is already buffered, e.g. from a failed commit
+		fmt.Fprintf(&h.buf, "error getting status: %v\nGet to retry\n", err)
+		h.flush()
+		return
 	}
 	debugf("status: %v", status)
+	h.mu.Lock()
+	h.shown, h.output = status, false
+	h.mu.Unlock()
 	coName := h.getMainName()
-	if status.branch == "master" || status.branch == "main" {
+	if status.Branch.Head == coName {
 		coName = tsbranch()
 	}
-	fmt.Fprintf(&h.buf, "on %s tracking %s\nCheckout %s\nCommit commit_message\n", status.branch, status.upstream, coName)
+	fmt.Fprintln(&h.buf, formatHeader(status.Branch))
+	if op := h.inProgress(); op != nil {
+		fmt.Fprintf(&h.buf, "%s IN PROGRESS\n\t%s\n", strings.ToUpper(op.name), strings.Join(op.cmds, " "))
+	}
+	fmt.Fprintf(&h.buf, "Checkout %s\nCommit commit_message\n", coName)
+	if status.Stash > 0 {
+		fmt.Fprintf(&h.buf, "Stashes (%d)\n", status.Stash)
+	}
 	formatStatus(&h.buf, status)
 	h.flush()
 }
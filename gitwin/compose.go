@@ -0,0 +1,160 @@
+// +commit composer windows, for multi-line messages, trailers and amends
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+const composeTag = "Put Get Amend Signoff NoVerify "
+
+// state for a +commit window
+type composeWin struct {
+	*childWin
+	amend    bool
+	signoff  bool
+	noVerify bool
+	file     string // set when we're git's editor, Put saves the message here
+}
+
+// Compose opens a +commit window for writing a commit message
+func (h *handler) ExecCompose(cmd string) error {
+	c, err := h.newChild("+commit", composeTag)
+	if err != nil {
+		return err
+	}
+	cw := &composeWin{childWin: c}
+	go func() {
+		cw.render(strings.TrimSpace(cmd))
+		runEvents(c.w, cw)
+	}()
+	return nil
+}
+
+// the message in the window, without the comment lines
+func (cw *composeWin) message() string {
+	body, err := cw.w.ReadAll("body")
+	if err != nil {
+		return ""
+	}
+	var lines []string
+	for _, line := range strings.Split(string(body), "\n") {
+		if !strings.HasPrefix(line, "#") {
+			lines = append(lines, line)
+		}
+	}
+	return strings.TrimSpace(strings.Join(lines, "\n"))
+}
+
+// what an amended commit will be compared against: HEAD's parent, or the
+// empty tree when HEAD is a root commit and has none
+func (h *handler) amendBase() string {
+	if _, err := gitOutput(h.path, "rev-parse", "--verify", "--quiet", "HEAD~1^{commit}"); err == nil {
+		return "HEAD~1"
+	}
+	// the empty tree's hash depends on the repo's hash function
+	if out, err := execGit(h.path, []byte{}, false, "hash-object", "-t", "tree", "--stdin"); err == nil {
+		return strings.TrimSpace(string(out))
+	}
+	return "4b825dc642cb6eb9a060e54bf8d69288fbee4904"
+}
+
+// write msg into the window followed by the template comments
+func (cw *composeWin) render(msg string) {
+	fmt.Fprintf(&cw.buf, "%s\n\n", msg)
+	fmt.Fprintln(&cw.buf, "# Write the commit message above, lines starting with # are dropped.")
+	fmt.Fprintln(&cw.buf, "# Put commits, Amend, Signoff and NoVerify toggle the matching git commit flags.")
+	fmt.Fprintf(&cw.buf, "# amend: %v, signoff: %v, no-verify: %v\n", cw.amend, cw.signoff, cw.noVerify)
+	fmt.Fprintln(&cw.buf, "#")
+	args := []string{"diff", "--cached", "--name-status"}
+	if cw.amend {
+		// an amend replaces HEAD, so compare against its parent
+		args = append(args, cw.repo.amendBase())
+	}
+	staged, err := gitOutput(cw.repo.path, args...)
+	switch {
+	case err != nil:
+		fmt.Fprintf(&cw.buf, "# error listing staged files: %v\n", err)
+	case len(bytes.TrimSpace(staged)) == 0:
+		fmt.Fprintln(&cw.buf, "# nothing staged")
+	default:
+		fmt.Fprintln(&cw.buf, "# Changes to be committed:")
+		for _, line := range strings.Split(strings.TrimSpace(string(staged)), "\n") {
+			fmt.Fprintf(&cw.buf, "#\t%s\n", line)
+		}
+	}
+	cw.flush()
+	cw.w.Addr("#0")
+	cw.w.Ctl("dot=addr")
+}
+
+// refresh the list of staged files, keeping the message
+func (cw *composeWin) ExecGet(cmd string) {
+	cw.render(cw.message())
+}
+
+// toggle --amend, pulling in the previous message if there isn't one yet
+func (cw *composeWin) ExecAmend(cmd string) {
+	cw.amend = !cw.amend
+	msg := cw.message()
+	if cw.amend && msg == "" {
+		if prev, err := gitOutput(cw.repo.path, "log", "-1", "--format=%B"); err == nil {
+			msg = strings.TrimSpace(string(prev))
+		}
+	}
+	cw.render(msg)
+}
+
+func (cw *composeWin) ExecSignoff(cmd string) {
+	cw.signoff = !cw.signoff
+	cw.render(cw.message())
+}
+
+func (cw *composeWin) ExecNoVerify(cmd string) {
+	cw.noVerify = !cw.noVerify
+	cw.render(cw.message())
+}
+
+// commit with the message in the window, which stays open if the commit
+// fails, e.g. because of a hook, so the message isn't lost
+func (cw *composeWin) ExecPut(cmd string) error {
+	if cw.file != "" {
+		// git does its own comment stripping
+		body, err := cw.w.ReadAll("body")
+		if err != nil {
+			return err
+		}
+		if err := os.WriteFile(cw.file, body, 0644); err != nil {
+			return err
+		}
+		cw.w.Del(true)
+		return nil
+	}
+	msg := cw.message()
+	if msg == "" && !cw.amend {
+		return errors.New("empty commit message")
+	}
+	args := []string{"commit", "--cleanup=strip", "-F", "-"}
+	if cw.amend {
+		args = append(args, "--amend")
+	}
+	if cw.signoff {
+		args = append(args, "--signoff")
+	}
+	if cw.noVerify {
+		args = append(args, "--no-verify")
+	}
+	return cw.repo.command(func() error {
+		out, err := execGit(cw.repo.path, []byte(msg+"\n"), true, args...)
+		if err != nil {
+			return fmt.Errorf("%v\n%s", err, out)
+		}
+		cw.repo.buf.Write(out)
+		cw.repo.ExecGet("")
+		cw.w.Del(true)
+		return nil
+	})
+}
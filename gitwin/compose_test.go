@@ -0,0 +1,17 @@
+package main
+
+import "testing"
+
+func TestAmendBase(t *testing.T) {
+	dir := testRepo(t)
+	h := &handler{path: dir}
+	commitFile(t, dir, "a.txt", "1")
+	// a root commit has no parent, so amending it compares with nothing
+	if got := mustGit(t, dir, "diff", "--cached", "--name-status", h.amendBase()); got != "A\ta.txt" {
+		t.Errorf("staged for amending the root commit = %q, want %q", got, "A\ta.txt")
+	}
+	commitFile(t, dir, "a.txt", "2")
+	if got := h.amendBase(); got != "HEAD~1" {
+		t.Errorf("amendBase = %q, want HEAD~1", got)
+	}
+}
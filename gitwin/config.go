@@ -0,0 +1,156 @@
+// per repo settings, read from git config or a .gitwin file in the repo root
+// (which uses the same syntax as git config), e.g.
+//
+//	[gitwin]
+//		mainBranch = trunk
+//		pushPolicy = force-with-lease
+//		lsExclude = testdata/ node_modules/ *.pb.go
+//		lsInclude = *.go
+//
+// lsExclude and lsInclude can be repeated or hold several space separated
+// globs, they filter Ls, LsTree and Grep. a glob ending in / matches a
+// directory, anywhere in the tree if it has no other /, one without a /
+// matches file names, and anything else matches the whole path. without
+// lsExclude vendor/ is skipped.
+//
+// the remote and the forge settings for the PR commands (forge, forgeURL
+// and forgeRepo, see forge.go) are only read from git config. git push
+// takes a URL as well as a remote name and the forge API gets sent the
+// user's token, so a cloned .gitwin shouldn't get to choose where either
+// goes:
+//
+//	git config gitwin.remote upstream
+//	git config gitwin.forge gitea
+//	git config gitwin.forgeURL https://git.example.com/api/v1
+//
+// git config wins over .gitwin so people can override what's checked in.
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// what Push does
+const (
+	pushProtected      = "protected"        // pushes from the main branch go to a new timestamped branch
+	pushDirect         = "direct"           // push every branch as is
+	pushForceWithLease = "force-with-lease" // push every branch with --force-with-lease
+)
+
+type repoConfig struct {
+	remote     string
+	mainBranch string // empty to work it out from the remote's HEAD
+	pushPolicy string
+	lsInclude  []string // globs a listed file has to match, if any
+	lsExclude  []string // globs a listed file mustn't match
+	forge      string   // forgeGitHub or forgeGitea, empty to go by the remote
+	forgeURL   string   // API base URL, empty for the forge's usual one
+	forgeRepo  string   // owner/repo, empty to take it from the remote URL
+}
+
+// gitwin.* settings by key, lowercased as git gives them, each with every
+// value it's set to
+type configVars map[string][]string
+
+// read every gitwin.* setting at once, from git config or else the file
+func (h *handler) readConfig(file string) configVars {
+	args := []string{"config", "-z"}
+	if file != "" {
+		if _, err := os.Stat(file); err != nil {
+			return nil
+		}
+		args = append(args, "-f", file)
+	}
+	// exits 1 when nothing matches
+	out, _ := gitOutput(h.path, append(args, "--get-regexp", `^gitwin\.`)...)
+	vars := configVars{}
+	for _, rec := range strings.Split(string(out), "\x00") {
+		if rec == "" {
+			continue
+		}
+		key, value, _ := strings.Cut(rec, "\n")
+		key = strings.TrimPrefix(key, "gitwin.")
+		vars[key] = append(vars[key], value)
+	}
+	return vars
+}
+
+// the last value of a key, as git config --get gives it
+func (v configVars) value(key string) string {
+	vals := v[strings.ToLower(key)]
+	if len(vals) == 0 {
+		return ""
+	}
+	return vals[len(vals)-1]
+}
+
+// every value of a key split on spaces
+func (v configVars) values(key string) []string {
+	var all []string
+	for _, val := range v[strings.ToLower(key)] {
+		all = append(all, strings.Fields(val)...)
+	}
+	return all
+}
+
+func (h *handler) config() repoConfig {
+	git := h.readConfig("")
+	file := h.readConfig(filepath.Join(h.path, ".gitwin"))
+	value := func(key string) string {
+		if v := git.value(key); v != "" {
+			return v
+		}
+		return file.value(key)
+	}
+	values := func(key string) []string {
+		if v := git.values(key); v != nil {
+			return v
+		}
+		return file.values(key)
+	}
+	cfg := repoConfig{
+		remote:     git.value("remote"),
+		mainBranch: value("mainBranch"),
+		pushPolicy: value("pushPolicy"),
+		lsInclude:  values("lsInclude"),
+		lsExclude:  values("lsExclude"),
+		forge:      git.value("forge"),
+		forgeURL:   git.value("forgeURL"),
+		forgeRepo:  git.value("forgeRepo"),
+	}
+	if cfg.lsExclude == nil {
+		cfg.lsExclude = []string{"vendor/"}
+	}
+	if cfg.remote == "" {
+		cfg.remote = "origin"
+	}
+	switch cfg.pushPolicy {
+	case pushProtected, pushDirect, pushForceWithLease:
+	default:
+		if cfg.pushPolicy != "" {
+			debugf("unknown gitwin.pushPolicy %q, using %s", cfg.pushPolicy, pushProtected)
+		}
+		cfg.pushPolicy = pushProtected
+	}
+	return cfg
+}
+
+// the repo's default branch: configured, or whatever the remote's HEAD
+// points at, or failing that the first of a few common names that exists
+func (h *handler) getMainName() string {
+	cfg := h.config()
+	if cfg.mainBranch != "" {
+		return cfg.mainBranch
+	}
+	if out, err := gitOutput(h.path, "symbolic-ref", "--short", "refs/remotes/"+cfg.remote+"/HEAD"); err == nil {
+		return strings.TrimPrefix(strings.TrimSpace(string(out)), cfg.remote+"/")
+	}
+	for _, name := range []string{"main", "master", "trunk", "develop"} {
+		if h.hasRef("refs/heads/" + name) {
+			return name
+		}
+	}
+	return ""
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestConfig(t *testing.T) {
+	dir := testRepo(t)
+	writeFiles(t, dir, map[string]string{".gitwin": `[gitwin]
+	remote = https://evil.example.com/steal.git
+	mainBranch = trunk
+	pushPolicy = direct
+	lsExclude = testdata/
+	lsExclude = *.pb.go node_modules/
+	forgeURL = https://evil.example.com/api
+`})
+	h := &handler{path: dir}
+	want := repoConfig{
+		remote:     "origin",
+		mainBranch: "trunk",
+		pushPolicy: pushDirect,
+		lsExclude:  []string{"testdata/", "*.pb.go", "node_modules/"},
+	}
+	if got := h.config(); !reflect.DeepEqual(got, want) {
+		t.Errorf(".gitwin only: config = %+v, want %+v", got, want)
+	}
+
+	mustGit(t, dir, "config", "gitwin.remote", "upstream")
+	mustGit(t, dir, "config", "gitwin.pushPolicy", "force-with-lease")
+	mustGit(t, dir, "config", "--add", "gitwin.lsInclude", "*.go")
+	mustGit(t, dir, "config", "--add", "gitwin.lsInclude", "*.md go.mod")
+	mustGit(t, dir, "config", "gitwin.forge", "gitea")
+	want = repoConfig{
+		remote:     "upstream",
+		mainBranch: "trunk",
+		pushPolicy: pushForceWithLease,
+		lsInclude:  []string{"*.go", "*.md", "go.mod"},
+		lsExclude:  []string{"testdata/", "*.pb.go", "node_modules/"},
+		forge:      forgeGitea,
+	}
+	if got := h.config(); !reflect.DeepEqual(got, want) {
+		t.Errorf("with git config: config = %+v, want %+v", got, want)
+	}
+}
@@ -0,0 +1,244 @@
+// conflict mode: a +conflicts window listing unmerged paths with addresses
+// for each conflict, opened when a pull, rebase, merge etc stops on conflicts
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"9fans.net/go/acme"
+)
+
+const (
+	markerOurs   = "<<<<<<<"
+	markerBase   = "|||||||"
+	markerSep    = "======="
+	markerTheirs = ">>>>>>>"
+)
+
+// line numbers of the conflict markers that start each conflict in a file
+func conflictLines(path string) ([]int, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var lines []int
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(nil, 1024*1024)
+	for n := 1; scanner.Scan(); n++ {
+		if strings.HasPrefix(scanner.Text(), markerOurs) {
+			lines = append(lines, n)
+		}
+	}
+	return lines, scanner.Err()
+}
+
+// resolve every conflict in a file by keeping both sides, ours first,
+// dropping the base section of diff3 style conflicts
+func keepBoth(content []byte) []byte {
+	var out bytes.Buffer
+	// base and separator markers only count between <<<<<<< and >>>>>>>,
+	// anywhere else they're just text, e.g. a markdown heading underline
+	inConflict, inBase := false, false
+	for _, line := range bytes.SplitAfter(content, []byte("\n")) {
+		s := string(line)
+		switch {
+		case strings.HasPrefix(s, markerOurs):
+			inConflict, inBase = true, false
+			continue
+		case !inConflict:
+		case strings.HasPrefix(s, markerTheirs):
+			inConflict, inBase = false, false
+			continue
+		case strings.HasPrefix(s, markerBase):
+			inBase = true
+			continue
+		case strings.HasPrefix(s, markerSep):
+			inBase = false
+			continue
+		case inBase:
+			continue
+		}
+		out.Write(line)
+	}
+	return out.Bytes()
+}
+
+// reload the acme window for a file, if it's open
+func reloadFile(path string) {
+	wins, _ := acme.Windows()
+	for _, wi := range wins {
+		if wi.Name == path {
+			if w, err := acme.Open(wi.ID, nil); err == nil {
+				w.Ctl("clean")
+				w.Ctl("get")
+			}
+		}
+	}
+}
+
+// state for a +conflicts window
+type conflictWin struct {
+	*childWin
+
+	// held while redrawing, which happens from the window's own events and
+	// from the +git window when something else stops on conflicts
+	mu sync.Mutex
+}
+
+// open the conflicts window if there are unmerged paths and it isn't open
+// already. this runs after commands rather than as one, so it reports
+// errors itself
+func (h *handler) checkConflicts() {
+	status, err := h.gitPorcelain()
+	if err != nil || len(status.Unmerged) == 0 {
+		return
+	}
+	if err := h.ExecConflicts(""); err != nil {
+		h.w.Errf("%v", err)
+	}
+}
+
+// Conflicts opens the +conflicts window, along with every conflicted file
+func (h *handler) ExecConflicts(cmd string) error {
+	h.mu.Lock()
+	// the close path can clear h.conflicts as soon as the lock goes
+	if cw := h.conflicts; cw != nil {
+		h.mu.Unlock()
+		cw.w.Ctl("show")
+		cw.ExecGet("")
+		return nil
+	}
+	c, err := h.newChild("+conflicts", "Get Continue Abort ")
+	if err != nil {
+		h.mu.Unlock()
+		return err
+	}
+	cw := &conflictWin{childWin: c}
+	h.conflicts = cw
+	h.mu.Unlock()
+	go func() {
+		if status, err := h.gitPorcelain(); err == nil {
+			for _, u := range status.Unmerged {
+				openFile(filepath.Join(h.path, u.Path))
+			}
+		}
+		cw.ExecGet("")
+		runEvents(c.w, cw)
+		h.mu.Lock()
+		h.conflicts = nil
+		h.mu.Unlock()
+	}()
+	return nil
+}
+
+func (cw *conflictWin) ExecGet(cmd string) {
+	cw.mu.Lock()
+	defer cw.mu.Unlock()
+	status, err := cw.repo.gitPorcelain()
+	if err != nil {
+		fmt.Fprintln(&cw.buf, err)
+		cw.flush()
+		return
+	}
+	op := cw.repo.inProgress()
+	if op != nil {
+		fmt.Fprintf(&cw.buf, "%s IN PROGRESS\n\t%s\n", strings.ToUpper(op.name), strings.Join(op.cmds, " "))
+	}
+	if len(status.Unmerged) == 0 {
+		fmt.Fprintln(&cw.buf, "no conflicts left")
+	}
+	for _, u := range status.Unmerged {
+		path := filepath.Join(cw.repo.path, u.Path)
+		fmt.Fprintf(&cw.buf, "%s: %s\n", describeUnmerged(u), u.Path)
+		if lines, err := conflictLines(path); err == nil && len(lines) > 0 {
+			fmt.Fprintf(&cw.buf, "\t%s:/%s/\n", path, markerOurs)
+			for _, n := range lines {
+				fmt.Fprintf(&cw.buf, "\t%s:%d\n", path, n)
+			}
+		}
+		fmt.Fprintf(&cw.buf, "\tOurs %s\tTheirs %s\tBoth %s\tMarkResolved %s\tOpen %s\n", u.Path, u.Path, u.Path, u.Path, u.Path)
+	}
+	cw.flush()
+}
+
+func (cw *conflictWin) ExecOurs(path string) error {
+	return cw.repo.command(func() error {
+		cw.repo.checkoutSide("--ours", path)
+		cw.ExecGet("")
+		return nil
+	})
+}
+
+func (cw *conflictWin) ExecTheirs(path string) error {
+	return cw.repo.command(func() error {
+		cw.repo.checkoutSide("--theirs", path)
+		cw.ExecGet("")
+		return nil
+	})
+}
+
+// keep both sides of every conflict in a file
+func (cw *conflictWin) ExecBoth(path string) error {
+	if path == "" {
+		return errors.New("usage: Both path")
+	}
+	full := filepath.Join(cw.repo.path, path)
+	content, err := os.ReadFile(full)
+	if err != nil {
+		return err
+	}
+	fi, err := os.Stat(full)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(full, keepBoth(content), fi.Mode()); err != nil {
+		return err
+	}
+	reloadFile(full)
+	cw.ExecGet("")
+	return nil
+}
+
+// git add a file, as long as there are no conflict markers left in it
+func (cw *conflictWin) ExecMarkResolved(path string) error {
+	if path == "" {
+		return errors.New("usage: MarkResolved path")
+	}
+	if lines, err := conflictLines(filepath.Join(cw.repo.path, path)); err == nil && len(lines) > 0 {
+		return fmt.Errorf("%s still has %d conflicts, starting at line %d", path, len(lines), lines[0])
+	}
+	return cw.repo.command(func() error {
+		cw.repo.ExecResolve(path)
+		cw.ExecGet("")
+		return nil
+	})
+}
+
+func (cw *conflictWin) ExecOpen(path string) error {
+	_, err := openFile(filepath.Join(cw.repo.path, path))
+	return err
+}
+
+func (cw *conflictWin) ExecContinue(cmd string) error {
+	return cw.repo.command(func() error {
+		err := cw.repo.ExecContinue("")
+		cw.ExecGet("")
+		return err
+	})
+}
+
+func (cw *conflictWin) ExecAbort(cmd string) error {
+	return cw.repo.command(func() error {
+		err := cw.repo.ExecAbort("")
+		cw.ExecGet("")
+		return err
+	})
+}
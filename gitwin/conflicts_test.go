@@ -0,0 +1,45 @@
+package main
+
+import "testing"
+
+func TestKeepBoth(t *testing.T) {
+	tests := []struct {
+		name, in, want string
+	}{
+		{
+			"merge",
+			"a\n<<<<<<< HEAD\nours\n=======\ntheirs\n>>>>>>> b\nz\n",
+			"a\nours\ntheirs\nz\n",
+		},
+		{
+			"diff3",
+			"<<<<<<< HEAD\nours\n||||||| base\nold\n=======\ntheirs\n>>>>>>> b\n",
+			"ours\ntheirs\n",
+		},
+		{
+			"two conflicts",
+			"<<<<<<< HEAD\n1\n=======\n2\n>>>>>>> b\nmid\n<<<<<<< HEAD\n3\n=======\n4\n>>>>>>> b",
+			"1\n2\nmid\n3\n4\n",
+		},
+		{
+			"markers outside a conflict",
+			"Title\n=======\n\n<<<<<<< HEAD\nours\n=======\ntheirs\n>>>>>>> b\n",
+			"Title\n=======\n\nours\ntheirs\n",
+		},
+		{
+			"base marker outside a conflict",
+			"|||||||\nkept\n<<<<<<< HEAD\nours\n=======\ntheirs\n>>>>>>> b\nafter\n",
+			"|||||||\nkept\nours\ntheirs\nafter\n",
+		},
+		{
+			"no conflicts",
+			"plain\n>>>>>>> text\n",
+			"plain\n>>>>>>> text\n",
+		},
+	}
+	for _, tt := range tests {
+		if got := string(keepBoth([]byte(tt.in))); got != tt.want {
+			t.Errorf("%s: keepBoth(%q) = %q, want %q", tt.name, tt.in, got, tt.want)
+		}
+	}
+}
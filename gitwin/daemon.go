@@ -0,0 +1,86 @@
+// daemon mode: one gitwin process reads the acme log and opens a +git
+// window for each repo that files get opened from
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// default location of the list of repos to open on startup in daemon mode
+func defaultReposFile() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "gitwin", "repos")
+}
+
+// read a list of repo paths, one per line, blank lines and #comments are skipped
+func readReposFile(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var repos []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line, _, _ := strings.Cut(scanner.Text(), "#")
+		if line = strings.TrimSpace(line); line != "" {
+			repos = append(repos, filepath.Clean(os.ExpandEnv(line)))
+		}
+	}
+	return repos, scanner.Err()
+}
+
+// cache of directory -> repo toplevel, "" for directories outside any repo,
+// so we don't fork git for every acme event
+var (
+	rootsMu sync.Mutex
+	roots   = map[string]string{}
+)
+
+func repoRoot(dir string) string {
+	rootsMu.Lock()
+	defer rootsMu.Unlock()
+	if root, ok := roots[dir]; ok {
+		return root
+	}
+	var out bytes.Buffer
+	root := ""
+	if runGit(dir, nil, &out, "rev-parse", "--show-toplevel") == nil {
+		root = strings.TrimSpace(out.String())
+	}
+	roots[dir] = root
+	return root
+}
+
+// open a +git window for the repo a newly opened acme window belongs to
+func autoOpen(name string) {
+	if !strings.HasPrefix(name, "/") || strings.Contains(name, "/+") {
+		return // not a file, or one of our own windows
+	}
+	if ownerOf(name) != nil {
+		return
+	}
+	dir := name
+	if fi, err := os.Stat(name); err != nil || !fi.IsDir() {
+		dir = filepath.Dir(name)
+	}
+	if fi, err := os.Stat(dir); err != nil || !fi.IsDir() {
+		return
+	}
+	root := repoRoot(dir)
+	if root == "" || findHandler(root) != nil {
+		return
+	}
+	debugf("auto-opening %s for %s", root, name)
+	if err := openRepo(root); err != nil {
+		debugf("error opening %s: %v", root, err)
+	}
+}
@@ -0,0 +1,134 @@
+// +diff windows, one per file or ref so the status window stays put
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// state for a +diff window
+type diffWin struct {
+	*childWin
+	desc string                 // what's being diffed, for when there's no diff
+	diff func() ([]byte, error) // produces the diff, with any error output
+}
+
+// open a diff window for the worktree (or index when staged is set)
+// against ref, limited to file when that's not empty
+func (h *handler) openDiff(ref string, staged bool, file string) error {
+	name := "+diff"
+	args := []string{"diff", "--no-color", "--no-ext-diff", "--src-prefix=a/", "--dst-prefix=b/"}
+	if staged {
+		name += ":staged"
+		args = append(args, "--cached")
+	}
+	if ref != "" {
+		name += "@" + ref
+		args = append(args, ref)
+	}
+	var files []string
+	if file != "" {
+		name += "/" + file
+		args = append(args, "--", file)
+		files = append(files, file)
+	}
+	if ref != "" {
+		// diffs against other refs aren't part of the backend
+		return h.showDiff(name, args...)
+	}
+	return h.openDiffWin(name, "git "+strings.Join(args, " "), func() ([]byte, error) {
+		return h.backend.Diff(staged, files...)
+	})
+}
+
+// open a diff window showing the output of git with args
+func (h *handler) showDiff(name string, args ...string) error {
+	return h.openDiffWin(name, "git "+strings.Join(args, " "), func() ([]byte, error) {
+		var out bytes.Buffer
+		err := runGit(h.path, nil, &out, args...)
+		return out.Bytes(), err
+	})
+}
+
+func (h *handler) openDiffWin(name, desc string, diff func() ([]byte, error)) error {
+	c, err := h.newChild(name, "Get ")
+	if err != nil {
+		return err
+	}
+	dw := &diffWin{childWin: c, desc: desc, diff: diff}
+	go func() {
+		dw.ExecGet("")
+		runEvents(c.w, dw)
+	}()
+	return nil
+}
+
+func (dw *diffWin) ExecGet(cmd string) {
+	out, err := dw.diff()
+	if err != nil {
+		dw.buf.Write(out)
+		fmt.Fprintln(&dw.buf, err)
+	} else if len(out) == 0 {
+		fmt.Fprintf(&dw.buf, "no output from %s\n", dw.desc)
+	} else {
+		dw.buf.WriteString(addressDiff(dw.repo.path, string(out)))
+	}
+	dw.flush()
+}
+
+// put a /path/to/file:line address before each hunk header, pointing at the
+// hunk's first changed line, so Look on it jumps into the file. the diff
+// needs the default b/ prefix, whatever diff.noprefix or diff.mnemonicPrefix
+// say, so the git commands producing it ask for that explicitly
+func addressDiff(dir, diff string) string {
+	var b strings.Builder
+	lines := strings.Split(strings.TrimSuffix(diff, "\n"), "\n")
+	file := ""
+	for i, line := range lines {
+		switch {
+		case strings.HasPrefix(line, "+++ "):
+			file = ""
+			if p, ok := strings.CutPrefix(line, "+++ b/"); ok {
+				file = filepath.Join(dir, p)
+			}
+		case strings.HasPrefix(line, "@@") && file != "":
+			if m := hunkHeaderRe.FindStringSubmatch(line); m != nil {
+				n := atoiDefault(m[3], 0)
+				for _, next := range lines[i+1:] {
+					if !strings.HasPrefix(next, " ") {
+						break
+					}
+					n++
+				}
+				fmt.Fprintf(&b, "%s:%d\n", file, n)
+			}
+		}
+		b.WriteString(line + "\n")
+	}
+	return b.String()
+}
+
+// Diff [path] shows unstaged changes
+func (h *handler) ExecDiff(cmd string) error {
+	return h.openDiff("", false, strings.TrimSpace(cmd))
+}
+
+// DiffStaged [path] shows staged changes
+func (h *handler) ExecDiffStaged(cmd string) error {
+	return h.openDiff("", true, strings.TrimSpace(cmd))
+}
+
+// DiffRef ref [path] shows the worktree against a ref
+func (h *handler) ExecDiffRef(cmd string) error {
+	f := strings.Fields(cmd)
+	switch len(f) {
+	case 1:
+		return h.openDiff(f[0], false, "")
+	case 2:
+		return h.openDiff(f[0], false, f[1])
+	}
+	return errors.New("usage: DiffRef ref [path]")
+}
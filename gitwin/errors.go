@@ -0,0 +1,94 @@
+// running git with retries on a locked index, and keeping one bad command
+// from taking down the whole process
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"runtime/debug"
+	"strings"
+	"time"
+
+	"9fans.net/go/acme"
+)
+
+// how often and how long to wait when another git process holds index.lock
+const (
+	lockRetries = 5
+	lockWait    = 200 * time.Millisecond
+)
+
+// a failed git command, with enough context to figure out what happened
+type gitError struct {
+	args   []string
+	dir    string
+	err    error
+	stderr string // empty when stderr went to the window with stdout
+}
+
+func (e *gitError) Error() string {
+	msg := fmt.Sprintf("git %s in %s: %v", strings.Join(e.args, " "), e.dir, e.err)
+	if s := strings.TrimSpace(e.stderr); s != "" {
+		msg += "\n" + s
+	}
+	return msg
+}
+
+// run git in dir and return its stdout, or stdout and stderr together when
+// combined is set, retrying for a bit when the index is locked
+func execGit(dir string, stdin []byte, combined bool, args ...string) ([]byte, error) {
+	for attempt := 0; ; attempt++ {
+		cmd := gitCommand(dir, args...)
+		if stdin != nil {
+			cmd.Stdin = bytes.NewReader(stdin)
+		}
+		var out, stderr bytes.Buffer
+		cmd.Stdout = &out
+		cmd.Stderr = &stderr
+		if combined {
+			cmd.Stderr = &out
+		}
+		debugf("running: %v", cmd)
+		err := cmd.Run()
+		if err == nil {
+			return out.Bytes(), nil
+		}
+		msg := stderr.String()
+		if combined {
+			msg = out.String()
+		}
+		if attempt < lockRetries && strings.Contains(msg, "index.lock") {
+			debugf("index locked for %v, retrying", cmd)
+			time.Sleep(lockWait)
+			continue
+		}
+		debugf("git error for %v: %v", cmd, err)
+		ge := &gitError{args: args, dir: dir, err: err}
+		if !combined {
+			ge.stderr = msg
+		}
+		return out.Bytes(), ge
+	}
+}
+
+// run git in dir and return its stdout, stderr ends up in the error
+func gitOutput(dir string, args ...string) ([]byte, error) {
+	return execGit(dir, nil, false, args...)
+}
+
+// run w's event loop, starting it again if a command panics
+// so that one bad command doesn't take down every window
+func runEvents(w *acme.Win, eh acme.EventHandler) {
+	for !runEventsOnce(w, eh) {
+	}
+}
+
+func runEventsOnce(w *acme.Win, eh acme.EventHandler) (done bool) {
+	defer func() {
+		if r := recover(); r != nil {
+			w.Errf("gitwin: panic handling event: %v\n%s", r, debug.Stack())
+		}
+	}()
+	w.EventLoop(eh)
+	return true
+}
@@ -0,0 +1,273 @@
+// pull requests on a forge's REST API, GitHub or Gitea, which share most of
+// their pulls endpoints. the base URL comes from the config so anything that
+// speaks the API will do, e.g. a local test server
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// the forges gitwin.forge accepts
+const (
+	forgeGitHub = "github"
+	forgeGitea  = "gitea"
+)
+
+type pullRequest struct {
+	number int
+	title  string
+	head   string // branch
+	base   string
+	author string
+	url    string // for people
+}
+
+// a review comment on a line of a file
+type reviewComment struct {
+	path   string
+	line   int // in the new version of the file, 0 if the line's gone
+	author string
+	body   string
+}
+
+type forge interface {
+	CreatePR(ctx context.Context, head, base, title, body string) (*pullRequest, error)
+	ListPRs(ctx context.Context) ([]pullRequest, error)
+	ReviewComments(ctx context.Context, number int) ([]reviewComment, error)
+}
+
+// a forge's REST API for one repo
+type restForge struct {
+	kind   string // forgeGitHub or forgeGitea
+	api    string // base URL, e.g. https://api.github.com
+	owner  string
+	repo   string
+	token  string
+	client *http.Client
+}
+
+func newRestForge(kind, api, owner, repo, token string) *restForge {
+	return &restForge{
+		kind:   kind,
+		api:    strings.TrimSuffix(api, "/"),
+		owner:  owner,
+		repo:   repo,
+		token:  token,
+		client: &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+// call the API, decoding the JSON response into out
+func (f *restForge) call(ctx context.Context, method, path string, in, out any) error {
+	var body io.Reader
+	if in != nil {
+		b, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(b)
+	}
+	u := fmt.Sprintf("%s/repos/%s/%s%s", f.api, url.PathEscape(f.owner), url.PathEscape(f.repo), path)
+	req, err := http.NewRequestWithContext(ctx, method, u, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	if f.kind == forgeGitHub {
+		req.Header.Set("Accept", "application/vnd.github+json")
+	}
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if f.token != "" {
+		// gitea takes "token", github takes both
+		req.Header.Set("Authorization", "token "+f.token)
+	}
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	b, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode/100 != 2 {
+		var apiErr struct {
+			Message string `json:"message"`
+		}
+		if json.Unmarshal(b, &apiErr) == nil && apiErr.Message != "" {
+			return fmt.Errorf("%s %s: %s: %s", method, u, resp.Status, apiErr.Message)
+		}
+		return fmt.Errorf("%s %s: %s", method, u, resp.Status)
+	}
+	if out == nil {
+		return nil
+	}
+	return json.Unmarshal(b, out)
+}
+
+// a pull request as both APIs return it
+type apiPull struct {
+	Number  int    `json:"number"`
+	Title   string `json:"title"`
+	HTMLURL string `json:"html_url"`
+	Head    struct {
+		Ref string `json:"ref"`
+	} `json:"head"`
+	Base struct {
+		Ref string `json:"ref"`
+	} `json:"base"`
+	User struct {
+		Login string `json:"login"`
+	} `json:"user"`
+}
+
+func (p apiPull) pullRequest() pullRequest {
+	return pullRequest{number: p.Number, title: p.Title, head: p.Head.Ref, base: p.Base.Ref, author: p.User.Login, url: p.HTMLURL}
+}
+
+func (f *restForge) CreatePR(ctx context.Context, head, base, title, body string) (*pullRequest, error) {
+	in := map[string]string{"head": head, "base": base, "title": title, "body": body}
+	var p apiPull
+	if err := f.call(ctx, "POST", "/pulls", in, &p); err != nil {
+		return nil, err
+	}
+	pr := p.pullRequest()
+	return &pr, nil
+}
+
+func (f *restForge) ListPRs(ctx context.Context) ([]pullRequest, error) {
+	var ps []apiPull
+	if err := f.call(ctx, "GET", "/pulls?state=open", nil, &ps); err != nil {
+		return nil, err
+	}
+	prs := make([]pullRequest, 0, len(ps))
+	for _, p := range ps {
+		prs = append(prs, p.pullRequest())
+	}
+	return prs, nil
+}
+
+func (f *restForge) ReviewComments(ctx context.Context, number int) ([]reviewComment, error) {
+	if f.kind == forgeGitea {
+		return f.giteaReviewComments(ctx, number)
+	}
+	var cs []struct {
+		Path string `json:"path"`
+		Line int    `json:"line"`
+		Body string `json:"body"`
+		User struct {
+			Login string `json:"login"`
+		} `json:"user"`
+	}
+	if err := f.call(ctx, "GET", fmt.Sprintf("/pulls/%d/comments", number), nil, &cs); err != nil {
+		return nil, err
+	}
+	var comments []reviewComment
+	for _, c := range cs {
+		comments = append(comments, reviewComment{path: c.Path, line: c.Line, author: c.User.Login, body: c.Body})
+	}
+	return comments, nil
+}
+
+// gitea hangs comments off reviews rather than the pull request
+func (f *restForge) giteaReviewComments(ctx context.Context, number int) ([]reviewComment, error) {
+	var reviews []struct {
+		ID int64 `json:"id"`
+	}
+	if err := f.call(ctx, "GET", fmt.Sprintf("/pulls/%d/reviews", number), nil, &reviews); err != nil {
+		return nil, err
+	}
+	var comments []reviewComment
+	for _, r := range reviews {
+		var cs []struct {
+			Path     string `json:"path"`
+			Position int    `json:"position"`
+			Body     string `json:"body"`
+			User     struct {
+				Login string `json:"login"`
+			} `json:"user"`
+		}
+		if err := f.call(ctx, "GET", fmt.Sprintf("/pulls/%d/reviews/%d/comments", number, r.ID), nil, &cs); err != nil {
+			return nil, err
+		}
+		for _, c := range cs {
+			comments = append(comments, reviewComment{path: c.Path, line: c.Position, author: c.User.Login, body: c.Body})
+		}
+	}
+	return comments, nil
+}
+
+// host, owner and repo from a remote URL in any of the usual forms:
+// https://host/owner/repo.git, ssh://git@host/owner/repo, git@host:owner/repo
+var remoteURLRe = regexp.MustCompile(`^(?:[a-z+]+://)?(?:[^@/]+@)?([^/:]+)(?::\d+)?[:/](.+?)/([^/]+?)(?:\.git)?/?$`)
+
+func parseRemoteURL(s string) (host, owner, repo string, err error) {
+	m := remoteURLRe.FindStringSubmatch(strings.TrimSpace(s))
+	if m == nil {
+		return "", "", "", fmt.Errorf("can't find owner/repo in remote url %q", s)
+	}
+	return m[1], m[2], m[3], nil
+}
+
+// the forge for the repo's remote. github.com is recognised, anything else
+// needs gitwin.forge, and gitwin.forgeURL for an API that isn't at the
+// usual place, both from git config only (see config.go). the token comes
+// from $GITWIN_FORGE_TOKEN, or else $GITHUB_TOKEN or $GITEA_TOKEN to match
+// the forge
+func (h *handler) forge() (forge, error) {
+	cfg := h.config()
+	out, err := gitOutput(h.path, "remote", "get-url", cfg.remote)
+	if err != nil {
+		return nil, err
+	}
+	host, owner, repo, err := parseRemoteURL(string(out))
+	if err != nil {
+		return nil, err
+	}
+	if cfg.forgeRepo != "" {
+		var ok bool
+		if owner, repo, ok = strings.Cut(cfg.forgeRepo, "/"); !ok {
+			return nil, fmt.Errorf("gitwin.forgeRepo should be owner/repo, not %q", cfg.forgeRepo)
+		}
+	}
+	kind := cfg.forge
+	if kind == "" && host == "github.com" {
+		kind = forgeGitHub
+	}
+	api := cfg.forgeURL
+	token := os.Getenv("GITWIN_FORGE_TOKEN")
+	switch kind {
+	case forgeGitHub:
+		if api == "" {
+			api = "https://api.github.com"
+		}
+		if token == "" {
+			token = os.Getenv("GITHUB_TOKEN")
+		}
+	case forgeGitea:
+		if api == "" {
+			api = "https://" + host + "/api/v1"
+		}
+		if token == "" {
+			token = os.Getenv("GITEA_TOKEN")
+		}
+	case "":
+		return nil, errors.New("don't know the forge for " + host + ", set gitwin.forge to " + forgeGitHub + " or " + forgeGitea)
+	default:
+		return nil, fmt.Errorf("unknown gitwin.forge %q, want %s or %s", kind, forgeGitHub, forgeGitea)
+	}
+	return newRestForge(kind, api, owner, repo, token), nil
+}
@@ -0,0 +1,215 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testPull = `{"number":3,"title":"add a thing","html_url":"https://forge/o/r/pull/3",
+	"head":{"ref":"feature"},"base":{"ref":"main"},"user":{"login":"me"}}`
+
+// a stand-in for the pulls endpoints of both APIs
+func newTestForgeServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	mux := http.NewServeMux()
+	mux.HandleFunc("/repos/o/r/pulls", func(w http.ResponseWriter, r *http.Request) {
+		if got := r.Header.Get("Authorization"); got != "token secret" {
+			t.Errorf("Authorization = %q", got)
+		}
+		switch r.Method {
+		case "POST":
+			var in map[string]string
+			if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+				t.Errorf("decoding create body: %v", err)
+			}
+			want := map[string]string{"head": "feature", "base": "main", "title": "add a thing", "body": "because"}
+			if !reflect.DeepEqual(in, want) {
+				t.Errorf("create body = %v, want %v", in, want)
+			}
+			fmt.Fprint(w, testPull)
+		case "GET":
+			if r.URL.Query().Get("state") != "open" {
+				t.Errorf("listing with query %q", r.URL.RawQuery)
+			}
+			fmt.Fprintf(w, "[%s]", testPull)
+		}
+	})
+	mux.HandleFunc("/repos/o/r/pulls/3/comments", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `[{"path":"a.go","line":12,"body":"nit","user":{"login":"rev"}},
+			{"path":"b.go","line":0,"body":"gone","user":{"login":"rev"}}]`)
+	})
+	mux.HandleFunc("/repos/o/r/pulls/3/reviews", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `[{"id":7},{"id":9}]`)
+	})
+	mux.HandleFunc("/repos/o/r/pulls/3/reviews/7/comments", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `[{"path":"a.go","position":4,"body":"nit","user":{"login":"rev"}}]`)
+	})
+	mux.HandleFunc("/repos/o/r/pulls/3/reviews/9/comments", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `[{"path":"c/d.go","position":20,"body":"why?","user":{"login":"other"}}]`)
+	})
+	mux.HandleFunc("/repos/o/r/pulls/4/comments", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprint(w, `{"message":"Not Found"}`)
+	})
+	mux.HandleFunc("/repos/o/r/pulls/5/comments", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+		fmt.Fprint(w, `<html>bad gateway</html>`)
+	})
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestRestForge(t *testing.T) {
+	srv := newTestForgeServer(t)
+	wantPR := pullRequest{number: 3, title: "add a thing", head: "feature", base: "main", author: "me", url: "https://forge/o/r/pull/3"}
+	for _, kind := range []string{forgeGitHub, forgeGitea} {
+		t.Run(kind, func(t *testing.T) {
+			f := newRestForge(kind, srv.URL+"/", "o", "r", "secret")
+			pr, err := f.CreatePR(context.Background(), "feature", "main", "add a thing", "because")
+			if err != nil {
+				t.Fatalf("CreatePR: %v", err)
+			}
+			if *pr != wantPR {
+				t.Errorf("CreatePR = %+v, want %+v", *pr, wantPR)
+			}
+			prs, err := f.ListPRs(context.Background())
+			if err != nil {
+				t.Fatalf("ListPRs: %v", err)
+			}
+			if !reflect.DeepEqual(prs, []pullRequest{wantPR}) {
+				t.Errorf("ListPRs = %+v", prs)
+			}
+		})
+	}
+}
+
+func TestReviewComments(t *testing.T) {
+	srv := newTestForgeServer(t)
+	tests := []struct {
+		kind string
+		want []reviewComment
+	}{
+		{forgeGitHub, []reviewComment{
+			{path: "a.go", line: 12, author: "rev", body: "nit"},
+			{path: "b.go", line: 0, author: "rev", body: "gone"},
+		}},
+		// gitea's comments come from each review in turn
+		{forgeGitea, []reviewComment{
+			{path: "a.go", line: 4, author: "rev", body: "nit"},
+			{path: "c/d.go", line: 20, author: "other", body: "why?"},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.kind, func(t *testing.T) {
+			f := newRestForge(tt.kind, srv.URL, "o", "r", "secret")
+			got, err := f.ReviewComments(context.Background(), 3)
+			if err != nil {
+				t.Fatalf("ReviewComments: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ReviewComments = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestForgeErrors(t *testing.T) {
+	srv := newTestForgeServer(t)
+	f := newRestForge(forgeGitHub, srv.URL, "o", "r", "secret")
+	tests := []struct {
+		number int
+		want   string
+	}{
+		{4, "404 Not Found: Not Found"},
+		{5, "502 Bad Gateway"},
+	}
+	for _, tt := range tests {
+		_, err := f.ReviewComments(context.Background(), tt.number)
+		if err == nil || !strings.HasSuffix(err.Error(), tt.want) {
+			t.Errorf("ReviewComments(%d) error = %v, want one ending %q", tt.number, err, tt.want)
+		}
+	}
+}
+
+// Kill cancels the context, which has to stop a request the forge is sitting on
+func TestForgeCancel(t *testing.T) {
+	stop := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-stop:
+		}
+	}))
+	t.Cleanup(srv.Close)
+	defer close(stop)
+	f := newRestForge(forgeGitHub, srv.URL, "o", "r", "")
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		cancel()
+	}()
+	if _, err := f.ListPRs(ctx); !errors.Is(err, context.Canceled) {
+		t.Errorf("ListPRs error = %v, want %v", err, context.Canceled)
+	}
+}
+
+func TestPRHead(t *testing.T) {
+	dir := testRepo(t)
+	commitFile(t, dir, "a.txt", "1")
+	mustGit(t, dir, "remote", "add", "origin", "https://github.com/o/r.git")
+	mustGit(t, dir, "remote", "add", "me/fork", "git@github.com:me/r.git")
+	tests := []struct {
+		remote, merge, want string
+	}{
+		{"origin", "refs/heads/feature", "feature"},
+		{"origin", "refs/heads/team/feature", "team/feature"},
+		// a fork, with a slash in the remote's name and a different branch name
+		{"me/fork", "refs/heads/topic", "me:topic"},
+	}
+	h := &handler{path: dir}
+	for _, tt := range tests {
+		mustGit(t, dir, "config", "branch.main.remote", tt.remote)
+		mustGit(t, dir, "config", "branch.main.merge", tt.merge)
+		if got, err := h.prHead("main"); err != nil || got != tt.want {
+			t.Errorf("prHead with upstream %s %s = %q, %v, want %q", tt.remote, tt.merge, got, err, tt.want)
+		}
+	}
+}
+
+func TestParseRemoteURL(t *testing.T) {
+	tests := []struct {
+		url, host, owner, repo string
+	}{
+		{"https://github.com/schultzor/acmeutil.git", "github.com", "schultzor", "acmeutil"},
+		{"https://github.com/schultzor/acmeutil", "github.com", "schultzor", "acmeutil"},
+		{"https://git.example.com/o/r.git/\n", "git.example.com", "o", "r"},
+		{"ssh://git@git.example.com:2222/o/r.git", "git.example.com", "o", "r"},
+		{"ssh://git.example.com/o/r", "git.example.com", "o", "r"},
+		{"git@github.com:schultzor/acmeutil.git", "github.com", "schultzor", "acmeutil"},
+		{"git@github.com:schultzor/acmeutil", "github.com", "schultzor", "acmeutil"},
+	}
+	for _, tt := range tests {
+		host, owner, repo, err := parseRemoteURL(tt.url)
+		if err != nil {
+			t.Errorf("parseRemoteURL(%q): %v", tt.url, err)
+			continue
+		}
+		if host != tt.host || owner != tt.owner || repo != tt.repo {
+			t.Errorf("parseRemoteURL(%q) = %s %s %s, want %s %s %s", tt.url, host, owner, repo, tt.host, tt.owner, tt.repo)
+		}
+	}
+	for _, bad := range []string{"", "/local/path", "repo"} {
+		if _, _, _, err := parseRemoteURL(bad); err == nil {
+			t.Errorf("parseRemoteURL(%q) should fail", bad)
+		}
+	}
+}
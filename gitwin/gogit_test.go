@@ -0,0 +1,324 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-git/go-billy/v5/memfs"
+	"github.com/go-git/go-billy/v5/util"
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/storage/memory"
+	"github.com/schultzor/acmeutil/gitwin/porcelain"
+)
+
+// run git in dir, failing the test if it fails
+func mustGit(t *testing.T, dir string, args ...string) string {
+	t.Helper()
+	args = append([]string{"-c", "user.name=gitwin", "-c", "user.email=gitwin@example.com", "-c", "commit.gpgsign=false"}, args...)
+	out, err := execGit(dir, nil, true, args...)
+	if err != nil {
+		t.Fatalf("git %s: %v\n%s", strings.Join(args, " "), err, out)
+	}
+	return strings.TrimSpace(string(out))
+}
+
+// an empty repo on branch main
+func testRepo(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	mustGit(t, dir, "init", "-q", "-b", "main")
+	return dir
+}
+
+// write files, relative to dir
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		p := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// commit a change to file f, returning the new commit's hash
+func commitFile(t *testing.T, dir, f, content string) string {
+	t.Helper()
+	writeFiles(t, dir, map[string]string{f: content})
+	mustGit(t, dir, "add", f)
+	mustGit(t, dir, "commit", "-q", "-m", "change "+f)
+	return mustGit(t, dir, "rev-parse", "HEAD")
+}
+
+func TestAheadBehind(t *testing.T) {
+	dir := testRepo(t)
+	for i := 0; i < 5; i++ {
+		commitFile(t, dir, "base.txt", fmt.Sprint(i))
+	}
+	// origin/main moves on by three, with a merge in the middle
+	mustGit(t, dir, "checkout", "-q", "-b", "up")
+	commitFile(t, dir, "up.txt", "1")
+	mustGit(t, dir, "checkout", "-q", "-b", "side", "main")
+	commitFile(t, dir, "side.txt", "1")
+	mustGit(t, dir, "checkout", "-q", "up")
+	mustGit(t, dir, "merge", "-q", "--no-edit", "side")
+	commitFile(t, dir, "up.txt", "2")
+	mustGit(t, dir, "update-ref", "refs/remotes/origin/main", "up")
+	mustGit(t, dir, "checkout", "-q", "main")
+	mustGit(t, dir, "config", "remote.origin.url", "https://example.com/r.git")
+	mustGit(t, dir, "config", "remote.origin.fetch", "+refs/heads/*:refs/remotes/origin/*")
+	mustGit(t, dir, "config", "branch.main.remote", "origin")
+	mustGit(t, dir, "config", "branch.main.merge", "refs/heads/main")
+
+	check := func(step string) {
+		t.Helper()
+		want := mustGit(t, dir, "rev-list", "--left-right", "--count", "main...origin/main")
+		g, err := openGoGitRepo(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		s, err := g.Status()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := fmt.Sprintf("%d\t%d", s.Branch.Ahead, s.Branch.Behind); !s.Branch.HasAB || got != want {
+			t.Errorf("%s: ahead, behind = %q (HasAB %v), want %q", step, got, s.Branch.HasAB, want)
+		}
+		// and the +branches window shows the same as with git
+		if got, want := branchTrack(t, g), branchTrack(t, execRepo{dir: dir}); got != want {
+			t.Errorf("%s: main's track = %q, want %q", step, got, want)
+		}
+	}
+	check("behind")
+	commitFile(t, dir, "local.txt", "1")
+	commitFile(t, dir, "local.txt", "2")
+	check("diverged")
+	mustGit(t, dir, "merge", "-q", "--no-edit", "origin/main")
+	commitFile(t, dir, "local.txt", "3")
+	check("merged")
+	mustGit(t, dir, "update-ref", "refs/remotes/origin/main", "main")
+	check("up to date")
+}
+
+func branchTrack(t *testing.T, r repository) string {
+	t.Helper()
+	bs, err := r.Branches()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, b := range bs {
+		if b.name == "main" && !b.remote {
+			return b.track
+		}
+	}
+	t.Fatal("no branch main")
+	return ""
+}
+
+// the committed files in backendRepo, and what it does to them after
+var (
+	backendFiles = map[string]string{
+		"a.txt":        "one\ntwo\nthree\nfour\nfive\nsix\nseven\n",
+		"dir/b.txt":    "b\n",
+		"dir/sub/c.go": "package sub\n",
+		"gone.txt":     "going\n",
+		"moved.txt":    "moving\nalong\nnicely\n",
+	}
+	backendWrites = map[string]string{
+		"a.txt":        "one\n2\nthree\nfour\nfive\nsix\n7\n",
+		"dir/b.txt":    "b\nb\n",
+		"dir/sub/c.go": "package sub\n\nfunc C() {}\n",
+		"added.txt":    "new\n",
+		"untracked.md": "# not yet\n",
+	}
+	backendStaged = []string{"dir/b.txt", "added.txt"}
+)
+
+// a repo on disk with a commit and then changes staged, unstaged and
+// untracked, made with git
+func backendRepo(t *testing.T) string {
+	t.Helper()
+	dir := testRepo(t)
+	writeFiles(t, dir, backendFiles)
+	mustGit(t, dir, "add", ".")
+	mustGit(t, dir, "commit", "-q", "-m", "first")
+	writeFiles(t, dir, backendWrites)
+	mustGit(t, dir, append([]string{"add", "--"}, backendStaged...)...)
+	mustGit(t, dir, "rm", "-q", "--cached", "moved.txt")
+	if err := os.Rename(filepath.Join(dir, "moved.txt"), filepath.Join(dir, "dir/moved.txt")); err != nil {
+		t.Fatal(err)
+	}
+	mustGit(t, dir, "add", "dir/moved.txt")
+	if err := os.Remove(filepath.Join(dir, "gone.txt")); err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+// the same again in memory, made with go-git
+func memoryRepo(t *testing.T) *goGitRepo {
+	t.Helper()
+	fs := memfs.New()
+	r, err := git.InitWithOptions(memory.NewStorage(), fs, git.InitOptions{DefaultBranch: plumbing.NewBranchReferenceName("main")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	wt, err := r.Worktree()
+	if err != nil {
+		t.Fatal(err)
+	}
+	write := func(files map[string]string) {
+		for name, content := range files {
+			if err := util.WriteFile(fs, name, []byte(content), 0o644); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	add := func(paths ...string) {
+		for _, p := range paths {
+			if _, err := wt.Add(p); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	write(backendFiles)
+	add(".")
+	sig := &object.Signature{Name: "gitwin", Email: "gitwin@example.com", When: time.Now()}
+	if _, err := wt.Commit("first", &git.CommitOptions{Author: sig}); err != nil {
+		t.Fatal(err)
+	}
+	write(backendWrites)
+	add(backendStaged...)
+	if err := fs.Rename("moved.txt", "dir/moved.txt"); err != nil {
+		t.Fatal(err)
+	}
+	add("moved.txt", "dir/moved.txt")
+	if err := fs.Remove("gone.txt"); err != nil {
+		t.Fatal(err)
+	}
+	g, err := newGoGitRepo(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return g
+}
+
+// what both backends fill in of a status, go-git doesn't give modes or hashes
+func statusSummary(s *porcelain.Status) []string {
+	out := []string{"# " + s.Branch.Head}
+	for _, c := range s.Changed {
+		out = append(out, c.XY+" "+c.Path)
+	}
+	for _, r := range s.Renamed {
+		out = append(out, r.XY+" "+r.Path+" from "+r.OrigPath)
+	}
+	for _, u := range s.Unmerged {
+		out = append(out, u.XY+" "+u.Path)
+	}
+	for _, u := range s.Untracked {
+		out = append(out, "? "+u)
+	}
+	return out
+}
+
+// check two backends give the same status and diffs
+func compareBackends(t *testing.T, want, got repository) {
+	t.Helper()
+	ws, err := want.Status()
+	if err != nil {
+		t.Fatal(err)
+	}
+	gs, err := got.Status()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if w, g := statusSummary(ws), statusSummary(gs); !reflect.DeepEqual(w, g) {
+		t.Errorf("status:\n%s\nwant\n%s", strings.Join(g, "\n"), strings.Join(w, "\n"))
+	}
+	tests := []struct {
+		staged bool
+		paths  []string
+	}{
+		{false, nil},
+		{true, nil},
+		{false, []string{"dir"}},
+		{true, []string{"dir/b.txt"}},
+		{false, []string{"nothing/here"}},
+	}
+	for _, tt := range tests {
+		wd, err := want.Diff(tt.staged, tt.paths...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		gd, err := got.Diff(tt.staged, tt.paths...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(wd) != string(gd) {
+			t.Errorf("diff staged=%v %v:\n%s\nwant\n%s", tt.staged, tt.paths, gd, wd)
+		}
+	}
+}
+
+func TestBackendsAgree(t *testing.T) {
+	dir := backendRepo(t)
+	// go-git always writes a/ and b/, git has to be told to
+	mustGit(t, dir, "config", "diff.noprefix", "true")
+	g, err := openGoGitRepo(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	compareBackends(t, execRepo{dir: dir}, g)
+}
+
+func TestGoGitInMemory(t *testing.T) {
+	compareBackends(t, execRepo{dir: backendRepo(t)}, memoryRepo(t))
+}
+
+// the child windows call the backend from their own goroutines, run with
+// -race to see go-git's storage being shared
+func TestGoGitConcurrent(t *testing.T) {
+	dir := backendRepo(t)
+	for i := 0; i < 5; i++ {
+		commitFile(t, dir, "more.txt", fmt.Sprint(i))
+	}
+	// packed objects go through go-git's packfile cache
+	mustGit(t, dir, "gc", "-q")
+	g, err := openGoGitRepo(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var wg sync.WaitGroup
+	errs := make(chan error, 20)
+	for i := 0; i < 10; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			_, err := g.Status()
+			errs <- err
+		}()
+		go func() {
+			defer wg.Done()
+			_, err := g.Log(logQuery{count: 10})
+			errs <- err
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Error(err)
+		}
+	}
+}
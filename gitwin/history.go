@@ -0,0 +1,112 @@
+// per-file history: +history/<path> lists the commits touching a file,
+// following renames, and Look on a commit opens the file as it was then
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// state for a +history/<path> window
+type historyWin struct {
+	*childWin
+	path  string
+	paths map[string]string // commit hash to the file's path in that commit
+}
+
+// History path lists the commits that changed path
+func (h *handler) ExecHistory(cmd string) error {
+	path := strings.TrimSpace(cmd)
+	if path == "" {
+		return errors.New("usage: History path")
+	}
+	c, err := h.newChild("+history/"+path, "Get ")
+	if err != nil {
+		return err
+	}
+	hw := &historyWin{childWin: c, path: path}
+	go func() {
+		hw.ExecGet("")
+		runEvents(c.w, hw)
+	}()
+	return nil
+}
+
+func (hw *historyWin) ExecGet(cmd string) {
+	out, err := gitOutput(hw.repo.path, "log", "--follow", "--date=short", "--name-only",
+		"--format=%x00%h\t%an\t%ad\t%s", "--", hw.path)
+	if err != nil {
+		fmt.Fprintln(&hw.buf, err)
+		hw.flush()
+		return
+	}
+	hw.paths = map[string]string{}
+	fmt.Fprintf(&hw.buf, "history of %s, Look on a hash to open the file as of that commit\n\n", hw.path)
+	for _, rec := range strings.Split(string(out), "\x00") {
+		header, names, _ := strings.Cut(strings.TrimSpace(rec), "\n")
+		if header == "" {
+			continue
+		}
+		hash, _, _ := strings.Cut(header, "\t")
+		path := strings.TrimSpace(names)
+		if path == "" {
+			path = hw.path
+		}
+		hw.paths[hash] = path
+		fmt.Fprintln(&hw.buf, header)
+		if path != hw.path {
+			fmt.Fprintf(&hw.buf, "\t(as %s)\n", path)
+		}
+	}
+	hw.flush()
+}
+
+func (hw *historyWin) Look(arg string) bool {
+	arg = strings.TrimSpace(arg)
+	path, ok := hw.paths[arg]
+	if !ok {
+		return hw.repo.lookCommit(arg)
+	}
+	if err := hw.repo.openVersion(path, arg); err != nil {
+		hw.w.Errf("%v", err)
+	}
+	return true
+}
+
+// state for a read-only path@rev window
+type versionWin struct {
+	*childWin
+	path string
+	rev  string
+}
+
+func (h *handler) openVersion(path, rev string) error {
+	c, err := h.newChild(path+"@"+rev, "Get ")
+	if err != nil {
+		return err
+	}
+	vw := &versionWin{childWin: c, path: path, rev: rev}
+	go func() {
+		vw.ExecGet("")
+		runEvents(c.w, vw)
+	}()
+	return nil
+}
+
+func (vw *versionWin) ExecGet(cmd string) {
+	out, err := gitOutput(vw.repo.path, "show", vw.rev+":"+vw.path)
+	if err != nil {
+		fmt.Fprintln(&vw.buf, err)
+	} else {
+		vw.buf.Write(out)
+	}
+	vw.flush()
+	vw.w.Addr("#0")
+	vw.w.Ctl("dot=addr")
+}
+
+// old versions are read-only, stop acme writing out a path@rev file
+func (vw *versionWin) ExecPut(cmd string) error {
+	return fmt.Errorf("%s@%s is read-only", vw.path, vw.rev)
+}
@@ -0,0 +1,394 @@
+// per-hunk staging, roughly what `git add -p` does:
+// diff a single file, let the user pick hunks, then feed a patch made of
+// the picked hunks to `git apply --cached`
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+type hunkAction int
+
+const (
+	hunkPending hunkAction = iota
+	hunkStage
+	hunkSkip
+)
+
+func (a hunkAction) String() string {
+	switch a {
+	case hunkStage:
+		return "stage"
+	case hunkSkip:
+		return "skip"
+	}
+	return "-"
+}
+
+type hunk struct {
+	oldStart, oldCount int
+	newStart, newCount int
+	section            string   // anything after the closing @@, usually a function name
+	lines              []string // body lines, prefixed with ' ', '+', '-' or '\'
+	action             hunkAction
+}
+
+var hunkHeaderRe = regexp.MustCompile(`^@@ -(\d+)(?:,(\d+))? \+(\d+)(?:,(\d+))? @@(.*)$`)
+
+func atoiDefault(s string, def int) int {
+	if s == "" {
+		return def
+	}
+	n, _ := strconv.Atoi(s)
+	return n
+}
+
+func (h *hunk) header(newStart int) string {
+	return fmt.Sprintf("@@ -%d,%d +%d,%d @@%s", h.oldStart, h.oldCount, newStart, h.newCount, h.section)
+}
+
+// parse the output of `git diff` for a single file into its file header lines and hunks
+func parseDiff(diff string) ([]string, []*hunk, error) {
+	var header []string
+	var hunks []*hunk
+	var cur *hunk
+	lines := strings.Split(strings.TrimSuffix(diff, "\n"), "\n")
+	for _, line := range lines {
+		if strings.HasPrefix(line, "@@") {
+			m := hunkHeaderRe.FindStringSubmatch(line)
+			if m == nil {
+				return nil, nil, fmt.Errorf("bad hunk header: %q", line)
+			}
+			cur = &hunk{
+				oldStart: atoiDefault(m[1], 0),
+				oldCount: atoiDefault(m[2], 1),
+				newStart: atoiDefault(m[3], 0),
+				newCount: atoiDefault(m[4], 1),
+				section:  m[5],
+			}
+			hunks = append(hunks, cur)
+			continue
+		}
+		if cur == nil {
+			if line != "" {
+				header = append(header, line)
+			}
+			continue
+		}
+		cur.lines = append(cur.lines, line)
+	}
+	return header, hunks, nil
+}
+
+func isChange(line string) bool {
+	return strings.HasPrefix(line, "+") || strings.HasPrefix(line, "-")
+}
+
+// split a hunk into smaller hunks at the runs of context between its changes,
+// the context in between is shared by the hunks on either side of it
+func (h *hunk) split() []*hunk {
+	// find the [start, end) line index of each run of changes
+	type block struct{ start, end int }
+	var blocks []block
+	for i := 0; i < len(h.lines); i++ {
+		if !isChange(h.lines[i]) {
+			continue
+		}
+		b := block{start: i}
+		for i < len(h.lines) && (isChange(h.lines[i]) || strings.HasPrefix(h.lines[i], `\`)) {
+			i++
+		}
+		b.end = i
+		blocks = append(blocks, b)
+	}
+	if len(blocks) < 2 {
+		return []*hunk{h}
+	}
+	// old and new line numbers at the start of each body line
+	oldAt := make([]int, len(h.lines)+1)
+	newAt := make([]int, len(h.lines)+1)
+	oldAt[0], newAt[0] = h.oldStart, h.newStart
+	if h.oldCount == 0 {
+		oldAt[0]++
+	}
+	if h.newCount == 0 {
+		newAt[0]++
+	}
+	for i, line := range h.lines {
+		oldAt[i+1], newAt[i+1] = oldAt[i], newAt[i]
+		switch {
+		case strings.HasPrefix(line, "-"):
+			oldAt[i+1]++
+		case strings.HasPrefix(line, "+"):
+			newAt[i+1]++
+		case strings.HasPrefix(line, `\`):
+		default:
+			oldAt[i+1]++
+			newAt[i+1]++
+		}
+	}
+	var out []*hunk
+	for n := range blocks {
+		start := 0
+		if n > 0 {
+			start = blocks[n-1].end
+		}
+		end := len(h.lines)
+		if n < len(blocks)-1 {
+			end = blocks[n+1].start
+		}
+		sub := &hunk{
+			oldStart: oldAt[start],
+			newStart: newAt[start],
+			oldCount: oldAt[end] - oldAt[start],
+			newCount: newAt[end] - newAt[start],
+			section:  h.section,
+			lines:    append([]string{}, h.lines[start:end]...),
+		}
+		// an empty side of a hunk refers to the line before it
+		if sub.oldCount == 0 {
+			sub.oldStart--
+		}
+		if sub.newCount == 0 {
+			sub.newStart--
+		}
+		out = append(out, sub)
+	}
+	return out
+}
+
+// the range of old lines a hunk covers, [start, end)
+func (h *hunk) oldRange() (int, int) {
+	start := h.oldStart
+	if h.oldCount == 0 {
+		start++
+	}
+	return start, start + h.oldCount
+}
+
+// join b onto the end of h, where b starts within h's old lines as split
+// hunks do, sharing the context between them
+func (h *hunk) merge(b *hunk) *hunk {
+	_, end := h.oldRange()
+	start, _ := b.oldRange()
+	// drop b's leading lines that h already has
+	i := 0
+	for old := start; old < end && i < len(b.lines); i++ {
+		if !strings.HasPrefix(b.lines[i], "+") && !strings.HasPrefix(b.lines[i], `\`) {
+			old++
+		}
+	}
+	m := &hunk{
+		oldStart: h.oldStart,
+		newStart: h.newStart,
+		section:  h.section,
+		lines:    append(append([]string{}, h.lines...), b.lines[i:]...),
+		action:   h.action,
+	}
+	for _, line := range m.lines {
+		switch {
+		case strings.HasPrefix(line, "-"):
+			m.oldCount++
+		case strings.HasPrefix(line, "+"):
+			m.newCount++
+		case strings.HasPrefix(line, `\`):
+		default:
+			m.oldCount++
+			m.newCount++
+		}
+	}
+	return m
+}
+
+// build a patch out of the hunks marked for staging, adjusting the new
+// line numbers since unpicked hunks don't shift anything any more.
+// consecutive picked hunks that overlap, as the parts of a split hunk do,
+// are merged back together since git apply won't take overlapping hunks
+func buildPatch(header []string, hunks []*hunk) string {
+	var picked []*hunk
+	for _, h := range hunks {
+		if h.action != hunkStage {
+			continue
+		}
+		if n := len(picked); n > 0 {
+			_, end := picked[n-1].oldRange()
+			if start, _ := h.oldRange(); start < end {
+				picked[n-1] = picked[n-1].merge(h)
+				continue
+			}
+		}
+		picked = append(picked, h)
+	}
+	var b strings.Builder
+	for _, line := range header {
+		b.WriteString(line + "\n")
+	}
+	delta := 0
+	for _, h := range picked {
+		newStart := h.oldStart + delta
+		switch {
+		case h.oldCount == 0 && h.newCount > 0:
+			newStart++
+		case h.newCount == 0 && h.oldCount > 0:
+			newStart--
+		}
+		b.WriteString(h.header(newStart) + "\n")
+		for _, line := range h.lines {
+			b.WriteString(line + "\n")
+		}
+		delta += h.newCount - h.oldCount
+	}
+	return b.String()
+}
+
+// state for a +hunks window
+type hunkWin struct {
+	*childWin
+	file   string
+	header []string
+	hunks  []*hunk
+}
+
+func (h *handler) ExecHunks(cmd string) error {
+	file := strings.TrimSpace(cmd)
+	if file == "" {
+		return errors.New("usage: Hunks path/to/file")
+	}
+	c, err := h.newChild("+hunks/"+file, "Get Apply StageAll SkipAll ")
+	if err != nil {
+		return err
+	}
+	hw := &hunkWin{childWin: c, file: file}
+	go func() {
+		hw.ExecGet("")
+		runEvents(c.w, hw)
+	}()
+	return nil
+}
+
+// the unstaged diff for file, with the a/ and b/ prefixes `git apply`
+// expects whatever diff.noprefix or diff.mnemonicPrefix say
+func unstagedDiff(dir, file string) ([]byte, error) {
+	return gitOutput(dir, "diff", "--no-color", "--no-ext-diff", "--src-prefix=a/", "--dst-prefix=b/", "-U3", "--", file)
+}
+
+// re-read the unstaged diff for the file, forgetting any picks
+func (hw *hunkWin) ExecGet(cmd string) {
+	out, err := unstagedDiff(hw.repo.path, hw.file)
+	hw.header, hw.hunks = nil, nil
+	if err != nil {
+		fmt.Fprintf(&hw.buf, "error getting diff for %s: %v\n", hw.file, err)
+		hw.flush()
+		return
+	}
+	header, hunks, err := parseDiff(string(out))
+	if err != nil {
+		fmt.Fprintf(&hw.buf, "error parsing diff for %s: %v\n", hw.file, err)
+		hw.flush()
+		return
+	}
+	hw.header, hw.hunks = header, hunks
+	hw.render()
+}
+
+func (hw *hunkWin) render() {
+	if len(hw.hunks) == 0 {
+		fmt.Fprintf(&hw.buf, "no unstaged hunks in %s\n", hw.file)
+		hw.flush()
+		return
+	}
+	fmt.Fprintf(&hw.buf, "%s: %d hunks, pick with Stage n, Skip n, Split n or StageAll then Apply\n", hw.file, len(hw.hunks))
+	for i, h := range hw.hunks {
+		n := i + 1
+		fmt.Fprintf(&hw.buf, "\nStage %d\tSkip %d\tSplit %d\t[%s]\n", n, n, n, h.action)
+		fmt.Fprintln(&hw.buf, h.header(h.newStart))
+		for _, line := range h.lines {
+			fmt.Fprintln(&hw.buf, line)
+		}
+	}
+	hw.flush()
+}
+
+// parse a 1-based hunk number
+func (hw *hunkWin) pick(arg string) (*hunk, error) {
+	n, err := strconv.Atoi(arg)
+	if err != nil || n < 1 || n > len(hw.hunks) {
+		if arg == "" {
+			return nil, fmt.Errorf("which hunk? give a number, or use StageAll or SkipAll")
+		}
+		return nil, fmt.Errorf("no hunk %q in %s", arg, hw.file)
+	}
+	return hw.hunks[n-1], nil
+}
+
+func (hw *hunkWin) mark(arg string, a hunkAction) error {
+	h, err := hw.pick(arg)
+	if err != nil {
+		return err
+	}
+	h.action = a
+	hw.render()
+	return nil
+}
+
+func (hw *hunkWin) markAll(a hunkAction) {
+	for _, h := range hw.hunks {
+		h.action = a
+	}
+	hw.render()
+}
+
+func (hw *hunkWin) ExecStage(arg string) error {
+	return hw.mark(arg, hunkStage)
+}
+
+func (hw *hunkWin) ExecSkip(arg string) error {
+	return hw.mark(arg, hunkSkip)
+}
+
+func (hw *hunkWin) ExecStageAll(arg string) {
+	hw.markAll(hunkStage)
+}
+
+func (hw *hunkWin) ExecSkipAll(arg string) {
+	hw.markAll(hunkSkip)
+}
+
+func (hw *hunkWin) ExecSplit(arg string) error {
+	n, err := strconv.Atoi(arg)
+	if err != nil || n < 1 || n > len(hw.hunks) {
+		return fmt.Errorf("no hunk %q in %s", arg, hw.file)
+	}
+	parts := hw.hunks[n-1].split()
+	if len(parts) == 1 {
+		return fmt.Errorf("hunk %d can't be split any further", n)
+	}
+	hunks := append([]*hunk{}, hw.hunks[:n-1]...)
+	hunks = append(hunks, parts...)
+	hw.hunks = append(hunks, hw.hunks[n:]...)
+	hw.render()
+	return nil
+}
+
+// stage the picked hunks, then refresh this window and the status window
+func (hw *hunkWin) ExecApply(cmd string) error {
+	patch := buildPatch(hw.header, hw.hunks)
+	debugf("applying patch to index:\n%s", patch)
+	if !strings.Contains(patch, "\n@@") {
+		return fmt.Errorf("no hunks picked for staging in %s", hw.file)
+	}
+	return hw.repo.command(func() error {
+		var out bytes.Buffer
+		if err := runGit(hw.repo.path, strings.NewReader(patch), &out, "apply", "--cached", "-"); err != nil {
+			return fmt.Errorf("git apply --cached failed for %s: %v\n%s", hw.file, err, out.String())
+		}
+		hw.ExecGet("")
+		hw.repo.ExecGet("")
+		return nil
+	})
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func numbered(n int, edit func(i int) string) string {
+	var b strings.Builder
+	for i := 1; i <= n; i++ {
+		b.WriteString(edit(i))
+	}
+	return b.String()
+}
+
+func TestSplitStageAll(t *testing.T) {
+	before := numbered(12, func(i int) string { return strings.Repeat("x", i) + "\n" })
+	// three changes close enough together for a single hunk
+	after := numbered(12, func(i int) string {
+		switch i {
+		case 3:
+			return "changed\n"
+		case 6:
+			return ""
+		case 9:
+			return strings.Repeat("x", i) + "\nadded\n"
+		}
+		return strings.Repeat("x", i) + "\n"
+	})
+	tests := []struct {
+		name  string
+		stage []bool // for each part of the split hunk
+	}{
+		{"all", []bool{true, true, true}},
+		{"first two", []bool{true, true, false}},
+		{"last two", []bool{false, true, true}},
+		{"outer", []bool{true, false, true}},
+		{"middle", []bool{false, true, false}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// f.txt staged as before and changed to after in the work tree,
+			// with diffs configured without the prefixes the patches need
+			dir := testRepo(t)
+			mustGit(t, dir, "config", "diff.noprefix", "true")
+			writeFiles(t, dir, map[string]string{"f.txt": before})
+			mustGit(t, dir, "add", "f.txt")
+			writeFiles(t, dir, map[string]string{"f.txt": after})
+			out, err := unstagedDiff(dir, "f.txt")
+			if err != nil {
+				t.Fatal(err)
+			}
+			header, hunks, err := parseDiff(string(out))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(hunks) != 1 {
+				t.Fatalf("got %d hunks, want 1", len(hunks))
+			}
+			parts := hunks[0].split()
+			if len(parts) != len(tt.stage) {
+				t.Fatalf("split into %d, want %d", len(parts), len(tt.stage))
+			}
+			for i, stage := range tt.stage {
+				if stage {
+					parts[i].action = hunkStage
+				}
+			}
+			patch := buildPatch(header, parts)
+			var applyOut bytes.Buffer
+			if err := runGit(dir, strings.NewReader(patch), &applyOut, "apply", "--cached", "-"); err != nil {
+				t.Fatalf("apply --cached: %v\n%s\npatch:\n%s", err, applyOut.String(), patch)
+			}
+			// what's left unstaged should be exactly the parts not picked
+			out, err = unstagedDiff(dir, "f.txt")
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, left, err := parseDiff(string(out))
+			if err != nil {
+				t.Fatal(err)
+			}
+			var changes []string
+			for _, h := range left {
+				for _, line := range h.lines {
+					if isChange(line) {
+						changes = append(changes, line)
+					}
+				}
+			}
+			var want []string
+			for i, stage := range tt.stage {
+				if stage {
+					continue
+				}
+				for _, line := range parts[i].lines {
+					if isChange(line) {
+						want = append(want, line)
+					}
+				}
+			}
+			if strings.Join(changes, "\n") != strings.Join(want, "\n") {
+				t.Errorf("left unstaged %q, want %q", changes, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,132 @@
+// detecting rebases, merges etc that have stopped part way through
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/schultzor/acmeutil/gitwin/porcelain"
+)
+
+// a multi-step git operation that's waiting on the user
+type operation struct {
+	name string   // git subcommand, e.g. "rebase"
+	cmds []string // gitwin commands that make sense while it's in progress
+}
+
+// the files git leaves in its dir while each operation is in progress,
+// checked in order since e.g. a rebase can stop on a cherry-pick
+var operationMarkers = []struct {
+	file string
+	op   operation
+}{
+	{"rebase-merge", operation{"rebase", []string{"Continue", "Abort", "Skip"}}},
+	{"rebase-apply/applying", operation{"am", []string{"Continue", "Abort", "Skip"}}},
+	{"rebase-apply", operation{"rebase", []string{"Continue", "Abort", "Skip"}}},
+	{"MERGE_HEAD", operation{"merge", []string{"Continue", "Abort"}}},
+	{"CHERRY_PICK_HEAD", operation{"cherry-pick", []string{"Continue", "Abort", "Skip"}}},
+	{"REVERT_HEAD", operation{"revert", []string{"Continue", "Abort", "Skip"}}},
+	{"BISECT_LOG", operation{"bisect", []string{"Abort", "Skip"}}},
+}
+
+// absolute path of the repo's git dir, which is per worktree
+func (h *handler) gitDir() (string, error) {
+	out, err := gitOutput(h.path, "rev-parse", "--absolute-git-dir")
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// the operation currently in progress, or nil if there isn't one
+func (h *handler) inProgress() *operation {
+	dir, err := h.gitDir()
+	if err != nil {
+		debugf("error finding git dir: %v", err)
+		return nil
+	}
+	for _, m := range operationMarkers {
+		if _, err := os.Stat(filepath.Join(dir, m.file)); err == nil {
+			op := m.op
+			return &op
+		}
+	}
+	return nil
+}
+
+// first line of the status window, e.g. "on main tracking origin/main, ahead 1 behind 2"
+func formatHeader(b porcelain.Branch) string {
+	var s string
+	switch {
+	case b.Detached() && len(b.OID) > 8:
+		s = "HEAD detached at " + b.OID[:8]
+	case b.Detached():
+		s = "HEAD detached"
+	default:
+		s = "on " + b.Head
+	}
+	switch {
+	case b.Upstream == "":
+		s += ", no upstream"
+	case !b.HasAB:
+		s += " tracking " + b.Upstream + ", upstream is gone"
+	case b.Ahead == 0 && b.Behind == 0:
+		s += " tracking " + b.Upstream + ", up to date"
+	default:
+		s += fmt.Sprintf(" tracking %s, ahead %d behind %d", b.Upstream, b.Ahead, b.Behind)
+	}
+	return s
+}
+
+// run `git <op> <flag>` for the operation in progress, the editor is
+// stubbed out so e.g. a merge commit takes its default message. a rebase
+// goes on in the background instead, with git's editor opening +commit
+// windows as RebaseI's does, for any reword or squash still to come
+func (h *handler) continueOperation(flag string) error {
+	op := h.inProgress()
+	if op == nil {
+		fmt.Fprintln(&h.buf, "nothing in progress")
+		h.flush()
+		return nil
+	}
+	if op.name == "rebase" {
+		env, err := editorEnv()
+		if err != nil {
+			return err
+		}
+		return h.gitAsyncEnv(env, func(error) {
+			h.repoWindows("get")
+			h.checkConflicts()
+		}, "rebase", flag)
+	}
+	if op.name == "bisect" {
+		switch flag {
+		case "--abort":
+			h.git("bisect", "reset")
+		case "--skip":
+			h.git("bisect", "skip")
+		default:
+			fmt.Fprintln(&h.buf, "bisect can't be continued, use Skip or Abort")
+		}
+	} else {
+		h.git("-c", "core.editor=true", op.name, flag)
+	}
+	h.repoWindows("get")
+	h.ExecGet("")
+	h.checkConflicts()
+	return nil
+}
+
+func (h *handler) ExecContinue(cmd string) error {
+	return h.continueOperation("--continue")
+}
+
+func (h *handler) ExecAbort(cmd string) error {
+	return h.continueOperation("--abort")
+}
+
+func (h *handler) ExecSkip(cmd string) error {
+	return h.continueOperation("--skip")
+}
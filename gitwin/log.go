@@ -0,0 +1,175 @@
+// the +log commit browser and the per-commit windows it opens
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+const logPage = 50
+
+var hashRe = regexp.MustCompile(`^[0-9a-f]{7,40}$`)
+
+// state for a +log window
+type logWin struct {
+	*childWin
+	count   int
+	since   string
+	author  string
+	path    string
+	grep    string
+	pickaxe string
+}
+
+func (h *handler) ExecLog(cmd string) error {
+	return h.openLog(&logWin{path: strings.TrimSpace(cmd)})
+}
+
+func (h *handler) openLog(lw *logWin) error {
+	c, err := h.newChild("+log", "Get More Since Author Path ")
+	if err != nil {
+		return err
+	}
+	lw.childWin = c
+	if lw.count == 0 {
+		lw.count = logPage
+	}
+	go func() {
+		lw.ExecGet("")
+		runEvents(c.w, lw)
+	}()
+	return nil
+}
+
+func (lw *logWin) ExecGet(cmd string) {
+	filters := []string{fmt.Sprintf("last %d", lw.count)}
+	if lw.since != "" {
+		filters = append(filters, "since "+lw.since)
+	}
+	if lw.author != "" {
+		filters = append(filters, "by "+lw.author)
+	}
+	if lw.path != "" {
+		filters = append(filters, "touching "+lw.path)
+	}
+	if lw.grep != "" {
+		filters = append(filters, "with messages matching "+lw.grep)
+	}
+	if lw.pickaxe != "" {
+		filters = append(filters, fmt.Sprintf("adding or removing %q", lw.pickaxe))
+	}
+	fmt.Fprintf(&lw.buf, "commits: %s\n\n", strings.Join(filters, ", "))
+	entries, err := lw.repo.backend.Log(logQuery{
+		count:   lw.count,
+		since:   lw.since,
+		author:  lw.author,
+		path:    lw.path,
+		grep:    lw.grep,
+		pickaxe: lw.pickaxe,
+	})
+	if err != nil {
+		fmt.Fprintln(&lw.buf, err)
+	}
+	for _, e := range entries {
+		fmt.Fprintf(&lw.buf, "%s\t%s\t%s\t%s\n", e.hash, e.author, e.date, e.subject)
+	}
+	lw.flush()
+}
+
+// show another page of commits
+func (lw *logWin) ExecMore(cmd string) {
+	lw.count += logPage
+	lw.ExecGet("")
+}
+
+// limit to commits since a date git understands, e.g. "Since 2.weeks", empty to reset
+func (lw *logWin) ExecSince(arg string) {
+	lw.since = arg
+	lw.ExecGet("")
+}
+
+// limit to commits by a matching author, empty to reset
+func (lw *logWin) ExecAuthor(arg string) {
+	lw.author = arg
+	lw.ExecGet("")
+}
+
+// limit to commits touching a path, empty to reset
+func (lw *logWin) ExecPath(arg string) {
+	lw.path = arg
+	lw.ExecGet("")
+}
+
+func (lw *logWin) Look(arg string) bool {
+	return lw.repo.lookCommit(arg)
+}
+
+// open a commit window if arg looks like a commit hash
+func (h *handler) lookCommit(arg string) bool {
+	arg = strings.TrimSpace(arg)
+	if !hashRe.MatchString(arg) {
+		return false
+	}
+	if err := h.openCommit(arg); err != nil {
+		h.w.Errf("%v", err)
+	}
+	return true
+}
+
+// state for a +git/<hash> window
+type commitWin struct {
+	*childWin
+	hash string
+}
+
+func (h *handler) openCommit(hash string) error {
+	c, err := h.newChild("+git/"+hash, "Get CherryPick Revert Fixup CheckoutHere ")
+	if err != nil {
+		return err
+	}
+	cw := &commitWin{childWin: c, hash: hash}
+	go func() {
+		cw.ExecGet("")
+		runEvents(c.w, cw)
+	}()
+	return nil
+}
+
+func (cw *commitWin) ExecGet(cmd string) {
+	cw.git("show", "--no-color", "--format=fuller", "--stat", "-p", cw.hash)
+	cw.flush()
+}
+
+func (cw *commitWin) Look(arg string) bool {
+	return cw.repo.lookCommit(arg)
+}
+
+// run a git command against the commit, the output goes to the status window
+func (cw *commitWin) run(args ...string) error {
+	return cw.repo.command(func() error {
+		cw.repo.git(args...)
+		cw.repo.repoWindows("get")
+		cw.repo.ExecGet("")
+		cw.repo.checkConflicts()
+		return nil
+	})
+}
+
+func (cw *commitWin) ExecCherryPick(cmd string) error {
+	return cw.run("cherry-pick", cw.hash)
+}
+
+func (cw *commitWin) ExecRevert(cmd string) error {
+	return cw.run("revert", "--no-edit", cw.hash)
+}
+
+// commit what's staged as a fixup! for this commit, for a later rebase --autosquash
+func (cw *commitWin) ExecFixup(cmd string) error {
+	return cw.run("commit", "--fixup="+cw.hash)
+}
+
+// detach HEAD at this commit
+func (cw *commitWin) ExecCheckoutHere(cmd string) error {
+	return cw.run("checkout", "--detach", cw.hash)
+}
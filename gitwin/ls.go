@@ -0,0 +1,210 @@
+// listing tracked files: the include/exclude filters from the config, and
+// the +ls tree view
+package main
+
+import (
+	"fmt"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// whether a slash separated path matches a glob, see config.go for the rules
+func matchGlob(glob, p string) bool {
+	if dir, ok := strings.CutSuffix(glob, "/"); ok {
+		parts := strings.Split(p, "/")
+		for i := range parts[:len(parts)-1] {
+			if ok, _ := path.Match(dir, parts[i]); ok {
+				return true
+			}
+			// globs like a/b/ match that directory from the top
+			if ok, _ := path.Match(dir, strings.Join(parts[:i+1], "/")); ok {
+				return true
+			}
+		}
+		return false
+	}
+	if !strings.Contains(glob, "/") {
+		ok, _ := path.Match(glob, path.Base(p))
+		return ok
+	}
+	ok, _ := path.Match(glob, p)
+	return ok
+}
+
+// whether a file passes the configured filters
+func (cfg repoConfig) listed(p string) bool {
+	for _, g := range cfg.lsExclude {
+		if matchGlob(g, p) {
+			return false
+		}
+	}
+	if len(cfg.lsInclude) == 0 {
+		return true
+	}
+	for _, g := range cfg.lsInclude {
+		if matchGlob(g, p) {
+			return true
+		}
+	}
+	return false
+}
+
+// the tracked files, filtered unless all is set
+func (h *handler) lsFiles(all bool) ([]string, error) {
+	out, err := gitOutput(h.path, "ls-files", "-z")
+	if err != nil {
+		return nil, err
+	}
+	cfg := h.config()
+	var files []string
+	for _, f := range strings.Split(string(out), "\x00") {
+		if f != "" && (all || cfg.listed(f)) {
+			files = append(files, f)
+		}
+	}
+	return files, nil
+}
+
+// state for a +ls window
+type lsWin struct {
+	*childWin
+	all    bool
+	files  map[string]bool
+	dirs   map[string][]string // dir ("" for the top) to its entries, subdirs ending in /
+	status map[string]string   // path to its XY status, for changed files
+	open   map[string]bool     // expanded dirs
+}
+
+// LsTree [all] lists the tracked files by directory, Look on a directory
+// expands or collapses it and Look on a file opens it
+func (h *handler) ExecLsTree(cmd string) error {
+	c, err := h.newChild("+ls", "Get ")
+	if err != nil {
+		return err
+	}
+	lw := &lsWin{childWin: c, all: strings.TrimSpace(cmd) == "all", open: map[string]bool{}}
+	go func() {
+		lw.ExecGet("")
+		runEvents(c.w, lw)
+	}()
+	return nil
+}
+
+func (lw *lsWin) ExecGet(cmd string) {
+	files, err := lw.repo.lsFiles(lw.all)
+	if err != nil {
+		fmt.Fprintln(&lw.buf, err)
+		lw.flush()
+		return
+	}
+	lw.files = map[string]bool{}
+	lw.dirs = map[string][]string{}
+	seen := map[string]bool{}
+	for _, f := range files {
+		lw.files[f] = true
+		// add f and each of its parent dirs to the dir above
+		for child := f; child != "."; {
+			parent := path.Dir(child)
+			if parent == "." {
+				parent = ""
+			} else {
+				parent += "/"
+			}
+			entry := child
+			if child != f {
+				entry += "/"
+			}
+			if seen[entry] {
+				break
+			}
+			seen[entry] = true
+			lw.dirs[parent] = append(lw.dirs[parent], entry)
+			child = strings.TrimSuffix(parent, "/")
+			if child == "" {
+				break
+			}
+		}
+	}
+	for _, entries := range lw.dirs {
+		sort.Strings(entries)
+	}
+	lw.status = map[string]string{}
+	if status, err := lw.repo.gitPorcelain(); err == nil {
+		for _, x := range status.Changed {
+			lw.status[x.Path] = x.XY
+		}
+		for _, x := range status.Renamed {
+			lw.status[x.Path] = x.XY
+		}
+		for _, x := range status.Unmerged {
+			lw.status[x.Path] = x.XY
+		}
+	}
+	lw.render()
+}
+
+// how many changed files are under dir
+func (lw *lsWin) changedUnder(dir string) int {
+	n := 0
+	for p := range lw.status {
+		if strings.HasPrefix(p, dir) {
+			n++
+		}
+	}
+	return n
+}
+
+func (lw *lsWin) render() {
+	fmt.Fprintf(&lw.buf, "%d files, Look on a directory to expand it, on a file to open it\n\n", len(lw.files))
+	lw.renderDir("", 0)
+	lw.flush()
+}
+
+func (lw *lsWin) renderDir(dir string, depth int) {
+	indent := strings.Repeat("\t", depth)
+	for _, entry := range lw.dirs[dir] {
+		if !strings.HasSuffix(entry, "/") {
+			if xy := lw.status[entry]; xy != "" {
+				fmt.Fprintf(&lw.buf, "%s%s\t%s\n", indent, entry, xy)
+			} else {
+				fmt.Fprintf(&lw.buf, "%s%s\n", indent, entry)
+			}
+			continue
+		}
+		mark := "+"
+		if lw.open[entry] {
+			mark = "-"
+		}
+		fmt.Fprintf(&lw.buf, "%s%s %s", indent, mark, entry)
+		if n := lw.changedUnder(entry); n > 0 {
+			fmt.Fprintf(&lw.buf, "\t%d changed", n)
+		}
+		fmt.Fprintln(&lw.buf)
+		if lw.open[entry] {
+			lw.renderDir(entry, depth+1)
+		}
+	}
+}
+
+func (lw *lsWin) Look(arg string) bool {
+	arg = strings.TrimSpace(arg)
+	if _, ok := lw.dirs[arg]; ok && arg != "" {
+		lw.open[arg] = !lw.open[arg]
+		lw.render()
+		return true
+	}
+	if _, ok := lw.dirs[arg+"/"]; ok {
+		lw.open[arg+"/"] = !lw.open[arg+"/"]
+		lw.render()
+		return true
+	}
+	if lw.files[arg] {
+		if _, err := openFile(filepath.Join(lw.repo.path, arg)); err != nil {
+			lw.w.Errf("error opening %s: %v", arg, err)
+		}
+		return true
+	}
+	return false
+}
@@ -0,0 +1,37 @@
+package main
+
+import "testing"
+
+func TestMatchGlob(t *testing.T) {
+	tests := []struct {
+		glob, path string
+		want       bool
+	}{
+		// no slash: file names at any depth
+		{"*.go", "main.go", true},
+		{"*.go", "a/b/c.go", true},
+		{"*.go", "a/b/c.txt", false},
+		{"go.mod", "sub/go.mod", true},
+		{"*.go", "go/x.txt", false},
+		// trailing slash: directories, at any depth without another slash
+		{"vendor/", "vendor/x.go", true},
+		{"vendor/", "a/vendor/b/x.go", true},
+		{"vendor/", "vendor", false},
+		{"vendor/", "a/vendorx/y.go", false},
+		{"vendor/", "a/b/vendor", false},
+		{"node_*/", "web/node_modules/x.js", true},
+		// and from the top with one
+		{"a/b/", "a/b/c.go", true},
+		{"a/b/", "a/b/c/d.go", true},
+		{"a/b/", "x/a/b/c.go", false},
+		// any other slash: the whole path
+		{"cmd/*.go", "cmd/main.go", true},
+		{"cmd/*.go", "x/cmd/main.go", false},
+		{"cmd/*.go", "cmd/sub/main.go", false},
+	}
+	for _, tt := range tests {
+		if got := matchGlob(tt.glob, tt.path); got != tt.want {
+			t.Errorf("matchGlob(%q, %q) = %v, want %v", tt.glob, tt.path, got, tt.want)
+		}
+	}
+}
@@ -3,6 +3,15 @@
 // Usage:
 //
 //	gitwin /path/to/gitrepo/root
+//	gitwin -daemon [/path/to/gitrepo/root ...]
+//
+// With -daemon a single process watches the acme log and opens a +git window
+// for each repo that files get opened from, as well as any repos listed on the
+// command line or in the -repos file.
+//
+// The remote, main branch and push policy can be set per repo, see config.go.
+// With -backend go-git status, log, branches, diff, add and commit are done in
+// process instead of by running git, see repo.go.
 //
 // Available commands are defined in the commands.go, they can be enumerated by doing
 // a button 2 click on the "Help" command in the gitwin window.
@@ -11,15 +20,21 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"flag"
+	"fmt"
+	"io"
 	"log"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"slices"
 	"strings"
+	"sync"
 	"time"
 
 	"9fans.net/go/acme"
+	"github.com/schultzor/acmeutil/gitwin/porcelain"
 )
 
 // [go install .]
@@ -28,11 +43,27 @@ type handler struct {
 	w    *acme.Win
 	path string
 	buf  bytes.Buffer
+
+	// held by whatever is writing h.buf and the window: commands, the
+	// watcher and log refreshes, and background commands finishing
+	winMu sync.Mutex
+
+	mu      sync.Mutex
+	running string             // description of the background command, if any
+	cancel  context.CancelFunc // cancels the background command
+
+	conflicts *conflictWin      // open +conflicts window, if any
+	watching  bool              // whether watch is refreshing the window
+	output    bool              // whether the window shows a background command's output, which watch leaves alone
+	shown     *porcelain.Status // status the window was last drawn from
+
+	backend repository // status, log, branches, diff, add and commit go through here
 }
 
 var (
 	branchTemplate string
 	debugLogs      bool
+	backendName    string
 )
 
 func debugf(format string, args ...interface{}) {
@@ -52,40 +83,162 @@ func (h *handler) flush() {
 	h.buf = bytes.Buffer{}
 }
 
-func (h *handler) git(args ...string) error {
+func gitCommand(dir string, args ...string) *exec.Cmd {
 	cmd := exec.Command("git", args...)
-	cmd.Dir = h.path
-	cmd.Stdout = &h.buf
-	cmd.Stderr = &h.buf
-	debugf("running: %v", cmd)
-	err := cmd.Run()
+	cmd.Dir = dir
+	return cmd
+}
+
+// run a git command in dir, writing stdout and stderr to out
+func runGit(dir string, stdin io.Reader, out io.Writer, args ...string) error {
+	var in []byte
+	if stdin != nil {
+		var err error
+		if in, err = io.ReadAll(stdin); err != nil {
+			return err
+		}
+	}
+	b, err := execGit(dir, in, true, args...)
+	out.Write(b)
+	return err
+}
+
+// run git with its output going to h.buf, followed by the command and dir
+// if it fails, since git's own message doesn't always say what it was doing
+func (h *handler) git(args ...string) error {
+	err := runGit(h.path, nil, &h.buf, args...)
 	if err != nil {
-		debugf("git error for %v: %v", cmd, err)
+		fmt.Fprintln(&h.buf, err)
 	}
 	return err
 }
 
+// Look on a path listed in the body opens the file
 func (h *handler) Look(arg string) bool {
-	return false
+	arg = strings.TrimSpace(arg)
+	if arg == "" || filepath.IsAbs(arg) {
+		return false
+	}
+	path := filepath.Join(h.path, arg)
+	if !regularFile(path) {
+		return false
+	}
+	if _, err := openFile(path); err != nil {
+		h.w.Errf("error opening %s: %v", arg, err)
+	}
+	return true
 }
 
 func (h *handler) Execute(cmd string) bool {
 	return false
 }
 
-func readLog(h *handler, l *acme.LogReader) {
-	pfx := filepath.Clean(h.path + "/")
+// every handler in this process, one per repo or worktree
+var (
+	handlersMu sync.Mutex
+	handlers   []*handler
+	running    sync.WaitGroup
+)
+
+// create the +git window for the repo or worktree at path
+func newHandler(path string) (*handler, error) {
+	backend, err := newRepository(backendName, path)
+	if err != nil {
+		return nil, err
+	}
+	w, err := acme.New()
+	if err != nil {
+		return nil, err
+	}
+	w.Name("%s/+git", path)
+	w.SetErrorPrefix(path + "/+git")
+	w.Write("tag", []byte(mainTag))
+	h := &handler{path: path, w: w, backend: backend}
+	handlersMu.Lock()
+	handlers = append(handlers, h)
+	handlersMu.Unlock()
+	running.Add(1)
+	return h, nil
+}
+
+// handle events for the window until it's deleted
+func (h *handler) run() {
+	defer running.Done()
+	h.exclusive(func() { h.ExecGet("") })
+	stop := h.watch()
+	h.eventLoop()
+	stop()
+	handlersMu.Lock()
+	handlers = slices.DeleteFunc(handlers, func(x *handler) bool { return x == h })
+	handlersMu.Unlock()
+}
+
+// find the handler for a path, if one exists
+func findHandler(path string) *handler {
+	handlersMu.Lock()
+	defer handlersMu.Unlock()
+	for _, h := range handlers {
+		if h.path == path {
+			return h
+		}
+	}
+	return nil
+}
+
+// find the handler whose repo a file belongs to, worktrees can be nested
+// inside another checkout so the longest matching path wins
+func ownerOf(name string) *handler {
+	handlersMu.Lock()
+	defer handlersMu.Unlock()
+	var owner *handler
+	for _, h := range handlers {
+		if strings.HasPrefix(name, h.path+"/") && (owner == nil || len(h.path) > len(owner.path)) {
+			owner = h
+		}
+	}
+	return owner
+}
+
+// open a handler for path in this process, or show the existing one
+func openRepo(path string) error {
+	if h := findHandler(path); h != nil {
+		return h.w.Ctl("show")
+	}
+	h, err := newHandler(path)
+	if err != nil {
+		return err
+	}
+	go h.run()
+	return nil
+}
+
+func readLog(l *acme.LogReader, daemon bool) {
 	for {
 		event, err := l.Read()
 		if err != nil {
 			log.Fatal(err)
 		}
-		// update the git status output when a file in the repo is put/written by acme
-		if event.Name != "" && event.Op == "put" && strings.HasPrefix(event.Name, pfx) && event.Name != h.path {
-			debugf("readLog handling %v\n", event)
-			// no current way to send an event on the internal channel that EventLoop()
-			// uses to dispatch events, so call our Get method directly here :/
-			h.ExecGet("")
+		if event.Name == "" {
+			continue
+		}
+		switch event.Op {
+		case "put":
+			// update the git status output when a file in the repo is put/written by acme,
+			// unless the repo is being watched, which catches puts anyway
+			if h := ownerOf(event.Name); h != nil && !h.isWatching() {
+				debugf("readLog handling %v for %s\n", event, h.path)
+				// no current way to send an event on the internal channel that EventLoop()
+				// uses to dispatch events, so call our Get method directly here :/
+				h.exclusive(func() {
+					if h.busy() == "" && !h.showingOutput() {
+						h.ExecGet("")
+					}
+				})
+			}
+		case "new", "get":
+			if daemon {
+				autoOpen(event.Name)
+			}
 		}
 	}
 }
@@ -100,28 +253,68 @@ func main() {
 	if brPfx == "" {
 		brPfx = "branch"
 	}
+	var daemon, editor bool
+	var reposFile, todoFile string
 	flag.BoolVar(&debugLogs, "debug", false, "true to enable debug logging")
 	flag.StringVar(&branchTemplate, "branchTemplate", brPfx+"-200601021504", "template for default branch names, populated with time.Format")
+	flag.BoolVar(&daemon, "daemon", false, "true to open a +git window for every repo that files are opened from")
+	flag.StringVar(&backendName, "backend", backendExec, "how to read and update repos: "+backendExec+" to run git, "+backendGoGit+" to use go-git")
+	flag.StringVar(&reposFile, "repos", defaultReposFile(), "file listing repos to open on startup in daemon mode, one per line")
+	// used when gitwin runs itself as git's editors during an interactive rebase
+	flag.StringVar(&todoFile, "todo", "", "act as GIT_SEQUENCE_EDITOR, copying this todo list over git's")
+	flag.BoolVar(&editor, "editor", false, "act as GIT_EDITOR, editing the message file in a +commit window")
 	flag.Parse()
 	args := flag.Args()
+	switch {
+	case todoFile != "" || editor:
+		if len(args) != 1 {
+			log.Fatal("expected the file git wants edited")
+		}
+		if todoFile != "" {
+			err = runSequenceEditor(todoFile, args[0])
+		} else {
+			err = runMessageEditor(args[0])
+		}
+		if err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
 	if len(args) > 0 {
 		repoPath = args[0]
 	}
-	if err := os.Chdir(repoPath); err != nil {
-		log.Fatal("error doing chdir to repo:", err)
-	}
-	w, err := acme.New()
-	if err != nil {
+	if repoPath, err = filepath.Abs(repoPath); err != nil {
 		log.Fatal(err)
 	}
 	l, err := acme.Log()
 	if err != nil {
 		log.Fatal(err)
 	}
-	w.Name(repoPath + "/+git")
-	w.Write("tag", []byte("Get Diff Fetch Pull Branches Push Ls Log Help"))
-	h := handler{path: repoPath, w: w}
-	h.ExecGet("")
-	go readLog(&h, l)
-	w.EventLoop(&h)
+	if daemon {
+		repos, err := readReposFile(reposFile)
+		if err != nil && !os.IsNotExist(err) {
+			log.Printf("error reading %s: %v", reposFile, err)
+		}
+		repos = append(repos, args...)
+		for _, r := range repos {
+			if abs, err := filepath.Abs(r); err == nil {
+				r = abs
+			}
+			if err := openRepo(r); err != nil {
+				log.Printf("error opening %s: %v", r, err)
+			}
+		}
+		// run until acme goes away, regardless of how many windows are open
+		readLog(l, true)
+		return
+	}
+	if err := os.Chdir(repoPath); err != nil {
+		log.Fatal("error doing chdir to repo:", err)
+	}
+	if err := openRepo(repoPath); err != nil {
+		log.Fatal(err)
+	}
+	go readLog(l, false)
+	// keep going until the last window is closed
+	running.Wait()
 }
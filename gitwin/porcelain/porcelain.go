@@ -0,0 +1,273 @@
+// Package porcelain parses the output of
+//
+//	git status --porcelain=v2 -z --branch
+//
+// see https://git-scm.com/docs/git-status#_porcelain_format_version_2
+// for the details of the format.
+package porcelain
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Branch holds the "# branch.*" headers.
+type Branch struct {
+	OID      string // commit at HEAD, "(initial)" before the first commit
+	Head     string // current branch name, "(detached)" when HEAD is detached
+	Upstream string // empty when no upstream is set
+	// Ahead and Behind are only meaningful when HasAB is set, git leaves out
+	// the branch.ab header when there is no upstream or it is gone.
+	Ahead  int
+	Behind int
+	HasAB  bool
+}
+
+// Detached reports whether HEAD is detached.
+func (b Branch) Detached() bool {
+	return b.Head == "(detached)"
+}
+
+// Submodule is the <sub> field of an entry.
+type Submodule struct {
+	IsSubmodule   bool
+	CommitChanged bool // the submodule's HEAD moved
+	Modified      bool // tracked changes inside the submodule
+	Untracked     bool // untracked files inside the submodule
+}
+
+// Changed is an ordinary changed entry, the lines starting with "1".
+type Changed struct {
+	XY           string // staged and unstaged status, '.' for unmodified
+	Sub          Submodule
+	ModeHead     string // octal
+	ModeIndex    string // octal
+	ModeWorktree string // octal
+	HashHead     string
+	HashIndex    string
+	Path         string
+}
+
+// Staged reports whether the entry has changes in the index.
+func (c Changed) Staged() bool {
+	return c.XY[0] != '.'
+}
+
+// Unstaged reports whether the entry has changes in the worktree.
+func (c Changed) Unstaged() bool {
+	return c.XY[1] != '.'
+}
+
+// Renamed is a renamed or copied entry, the lines starting with "2".
+type Renamed struct {
+	Changed
+	Score    string // e.g. R100 or C75
+	OrigPath string
+}
+
+// Copied reports whether the entry is a copy rather than a rename.
+func (r Renamed) Copied() bool {
+	return strings.HasPrefix(r.Score, "C")
+}
+
+// Unmerged is an unmerged entry, the lines starting with "u".
+type Unmerged struct {
+	XY           string
+	Sub          Submodule
+	ModeStage1   string // octal
+	ModeStage2   string // octal
+	ModeStage3   string // octal
+	ModeWorktree string // octal
+	HashStage1   string
+	HashStage2   string
+	HashStage3   string
+	Path         string
+}
+
+// Status is the parsed output of a single `git status` run.
+type Status struct {
+	Branch    Branch
+	Stash     int // from "# stash", only present with --show-stash
+	Changed   []Changed
+	Renamed   []Renamed
+	Unmerged  []Unmerged
+	Untracked []string
+	Ignored   []string // only present with --ignored
+}
+
+// Parse parses NUL separated porcelain v2 output.
+func Parse(b []byte) (*Status, error) {
+	s := &Status{}
+	records := bytes.Split(b, []byte{0})
+	for i := 0; i < len(records); i++ {
+		rec := string(records[i])
+		if rec == "" {
+			continue
+		}
+		var err error
+		switch rec[0] {
+		case '#':
+			err = s.parseHeader(rec)
+		case '1':
+			err = s.parseChanged(rec)
+		case '2':
+			// the original path of a rename is the following record
+			if i+1 >= len(records) || len(records[i+1]) == 0 {
+				return nil, fmt.Errorf("porcelain: missing original path for %q", rec)
+			}
+			i++
+			err = s.parseRenamed(rec, string(records[i]))
+		case 'u':
+			err = s.parseUnmerged(rec)
+		case '?':
+			s.Untracked = append(s.Untracked, strings.TrimPrefix(rec, "? "))
+		case '!':
+			s.Ignored = append(s.Ignored, strings.TrimPrefix(rec, "! "))
+		default:
+			err = fmt.Errorf("porcelain: unknown record %q", rec)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+func (s *Status) parseHeader(rec string) error {
+	f := strings.Fields(rec)
+	if len(f) < 3 {
+		return fmt.Errorf("porcelain: malformed header %q", rec)
+	}
+	switch f[1] {
+	case "branch.oid":
+		s.Branch.OID = f[2]
+	case "branch.head":
+		s.Branch.Head = f[2]
+	case "branch.upstream":
+		s.Branch.Upstream = f[2]
+	case "branch.ab":
+		if len(f) != 4 {
+			return fmt.Errorf("porcelain: malformed header %q", rec)
+		}
+		ahead, err := strconv.Atoi(strings.TrimPrefix(f[2], "+"))
+		if err != nil {
+			return fmt.Errorf("porcelain: bad ahead count in %q", rec)
+		}
+		behind, err := strconv.Atoi(strings.TrimPrefix(f[3], "-"))
+		if err != nil {
+			return fmt.Errorf("porcelain: bad behind count in %q", rec)
+		}
+		s.Branch.Ahead, s.Branch.Behind, s.Branch.HasAB = ahead, behind, true
+	case "stash":
+		n, err := strconv.Atoi(f[2])
+		if err != nil {
+			return fmt.Errorf("porcelain: bad stash count in %q", rec)
+		}
+		s.Stash = n
+	}
+	// newer versions of git may add headers, skip anything unknown
+	return nil
+}
+
+// split a record into exactly n space separated fields, the last of which is
+// a path and may contain spaces itself
+func fields(rec string, n int) ([]string, error) {
+	f := strings.SplitN(rec, " ", n)
+	if len(f) != n || f[n-1] == "" {
+		return nil, fmt.Errorf("porcelain: expected %d fields in %q", n, rec)
+	}
+	if len(f[1]) != 2 {
+		return nil, fmt.Errorf("porcelain: bad XY field in %q", rec)
+	}
+	return f, nil
+}
+
+func parseSubmodule(sub string) (Submodule, error) {
+	if len(sub) != 4 {
+		return Submodule{}, fmt.Errorf("porcelain: bad submodule field %q", sub)
+	}
+	switch sub[0] {
+	case 'N':
+		return Submodule{}, nil
+	case 'S':
+		return Submodule{
+			IsSubmodule:   true,
+			CommitChanged: sub[1] == 'C',
+			Modified:      sub[2] == 'M',
+			Untracked:     sub[3] == 'U',
+		}, nil
+	}
+	return Submodule{}, fmt.Errorf("porcelain: bad submodule field %q", sub)
+}
+
+func parseChangedFields(f []string) (Changed, error) {
+	sub, err := parseSubmodule(f[2])
+	if err != nil {
+		return Changed{}, err
+	}
+	return Changed{
+		XY:           f[1],
+		Sub:          sub,
+		ModeHead:     f[3],
+		ModeIndex:    f[4],
+		ModeWorktree: f[5],
+		HashHead:     f[6],
+		HashIndex:    f[7],
+		Path:         f[len(f)-1],
+	}, nil
+}
+
+// 1 <XY> <sub> <mH> <mI> <mW> <hH> <hI> <path>
+func (s *Status) parseChanged(rec string) error {
+	f, err := fields(rec, 9)
+	if err != nil {
+		return err
+	}
+	c, err := parseChangedFields(f)
+	if err != nil {
+		return err
+	}
+	s.Changed = append(s.Changed, c)
+	return nil
+}
+
+// 2 <XY> <sub> <mH> <mI> <mW> <hH> <hI> <X><score> <path>, then <origPath>
+func (s *Status) parseRenamed(rec, orig string) error {
+	f, err := fields(rec, 10)
+	if err != nil {
+		return err
+	}
+	c, err := parseChangedFields(f)
+	if err != nil {
+		return err
+	}
+	s.Renamed = append(s.Renamed, Renamed{Changed: c, Score: f[8], OrigPath: orig})
+	return nil
+}
+
+// u <XY> <sub> <m1> <m2> <m3> <mW> <h1> <h2> <h3> <path>
+func (s *Status) parseUnmerged(rec string) error {
+	f, err := fields(rec, 11)
+	if err != nil {
+		return err
+	}
+	sub, err := parseSubmodule(f[2])
+	if err != nil {
+		return err
+	}
+	s.Unmerged = append(s.Unmerged, Unmerged{
+		XY:           f[1],
+		Sub:          sub,
+		ModeStage1:   f[3],
+		ModeStage2:   f[4],
+		ModeStage3:   f[5],
+		ModeWorktree: f[6],
+		HashStage1:   f[7],
+		HashStage2:   f[8],
+		HashStage3:   f[9],
+		Path:         f[10],
+	})
+	return nil
+}
@@ -0,0 +1,327 @@
+package porcelain
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const (
+	hashA = "1111111111111111111111111111111111111111"
+	hashB = "2222222222222222222222222222222222222222"
+	hashC = "3333333333333333333333333333333333333333"
+	zero  = "0000000000000000000000000000000000000000"
+)
+
+// join records as git status -z would write them
+func z(records ...string) []byte {
+	return []byte(strings.Join(records, "\x00") + "\x00")
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name string
+		in   []byte
+		want *Status
+	}{
+		{
+			name: "empty",
+			in:   nil,
+			want: &Status{},
+		},
+		{
+			name: "branch with upstream",
+			in: z(
+				"# branch.oid "+hashA,
+				"# branch.head main",
+				"# branch.upstream origin/main",
+				"# branch.ab +2 -13",
+				"# stash 3",
+			),
+			want: &Status{
+				Branch: Branch{OID: hashA, Head: "main", Upstream: "origin/main", Ahead: 2, Behind: 13, HasAB: true},
+				Stash:  3,
+			},
+		},
+		{
+			name: "detached",
+			in:   z("# branch.oid "+hashA, "# branch.head (detached)"),
+			want: &Status{Branch: Branch{OID: hashA, Head: "(detached)"}},
+		},
+		{
+			name: "initial",
+			in:   z("# branch.oid (initial)", "# branch.head main", "? new file.txt"),
+			want: &Status{
+				Branch:    Branch{OID: "(initial)", Head: "main"},
+				Untracked: []string{"new file.txt"},
+			},
+		},
+		{
+			name: "unknown header",
+			in:   z("# branch.head main", "# something.new from a later git"),
+			want: &Status{Branch: Branch{Head: "main"}},
+		},
+		{
+			name: "paths with spaces and tabs",
+			in: z(
+				"1 .M N... 100644 100644 100644 "+hashA+" "+hashA+" dir with spaces/a file.go",
+				"1 A. N... 000000 100644 100644 "+zero+" "+hashB+" tab\there.txt",
+				"? untracked\twith tab",
+				"? two  spaces",
+			),
+			want: &Status{
+				Changed: []Changed{
+					{XY: ".M", ModeHead: "100644", ModeIndex: "100644", ModeWorktree: "100644", HashHead: hashA, HashIndex: hashA, Path: "dir with spaces/a file.go"},
+					{XY: "A.", ModeHead: "000000", ModeIndex: "100644", ModeWorktree: "100644", HashHead: zero, HashIndex: hashB, Path: "tab\there.txt"},
+				},
+				Untracked: []string{"untracked\twith tab", "two  spaces"},
+			},
+		},
+		{
+			name: "rename and copy",
+			in: z(
+				"2 R. N... 100644 100644 100644 "+hashA+" "+hashA+" R100 new name.go", "old name.go",
+				"2 C. N... 100644 100644 100644 "+hashA+" "+hashB+" C75 copy.go", "orig.go",
+			),
+			want: &Status{
+				Renamed: []Renamed{
+					{
+						Changed:  Changed{XY: "R.", ModeHead: "100644", ModeIndex: "100644", ModeWorktree: "100644", HashHead: hashA, HashIndex: hashA, Path: "new name.go"},
+						Score:    "R100",
+						OrigPath: "old name.go",
+					},
+					{
+						Changed:  Changed{XY: "C.", ModeHead: "100644", ModeIndex: "100644", ModeWorktree: "100644", HashHead: hashA, HashIndex: hashB, Path: "copy.go"},
+						Score:    "C75",
+						OrigPath: "orig.go",
+					},
+				},
+			},
+		},
+		{
+			name: "unmerged",
+			in:   z("u UU N... 100644 100644 100644 100644 " + hashA + " " + hashB + " " + hashC + " conflicted file.go"),
+			want: &Status{
+				Unmerged: []Unmerged{{
+					XY:           "UU",
+					ModeStage1:   "100644",
+					ModeStage2:   "100644",
+					ModeStage3:   "100644",
+					ModeWorktree: "100644",
+					HashStage1:   hashA,
+					HashStage2:   hashB,
+					HashStage3:   hashC,
+					Path:         "conflicted file.go",
+				}},
+			},
+		},
+		{
+			name: "submodules",
+			in: z(
+				"1 .M S.M. 160000 160000 160000 "+hashA+" "+hashA+" lib/dirty",
+				"1 .M SC.. 160000 160000 160000 "+hashA+" "+hashA+" lib/moved",
+				"1 .M S..U 160000 160000 160000 "+hashA+" "+hashA+" lib/untracked",
+			),
+			want: &Status{
+				Changed: []Changed{
+					{XY: ".M", Sub: Submodule{IsSubmodule: true, Modified: true}, ModeHead: "160000", ModeIndex: "160000", ModeWorktree: "160000", HashHead: hashA, HashIndex: hashA, Path: "lib/dirty"},
+					{XY: ".M", Sub: Submodule{IsSubmodule: true, CommitChanged: true}, ModeHead: "160000", ModeIndex: "160000", ModeWorktree: "160000", HashHead: hashA, HashIndex: hashA, Path: "lib/moved"},
+					{XY: ".M", Sub: Submodule{IsSubmodule: true, Untracked: true}, ModeHead: "160000", ModeIndex: "160000", ModeWorktree: "160000", HashHead: hashA, HashIndex: hashA, Path: "lib/untracked"},
+				},
+			},
+		},
+		{
+			name: "ignored",
+			in:   z("? a.go", "! build/", "! with space.o"),
+			want: &Status{Untracked: []string{"a.go"}, Ignored: []string{"build/", "with space.o"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Parse(tt.in)
+			if err != nil {
+				t.Fatalf("Parse: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Parse =\n%+v\nwant\n%+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		in   []byte
+	}{
+		{"truncated changed", z("1 .M N... 100644 100644 100644 " + hashA)},
+		{"truncated unmerged", z("u UU N... 100644 100644 100644 100644 " + hashA + " " + hashB)},
+		{"changed with no path", z("1 .M N... 100644 100644 100644 " + hashA + " " + hashA + " ")},
+		{"rename at the end", z("2 R. N... 100644 100644 100644 " + hashA + " " + hashA + " R100 new.go")},
+		{"rename with no NUL after it", []byte("2 R. N... 100644 100644 100644 " + hashA + " " + hashA + " R100 new.go")},
+		{"short XY", z("1 M N... 100644 100644 100644 " + hashA + " " + hashA + " a.go")},
+		{"long XY", z("1 .MM N... 100644 100644 100644 " + hashA + " " + hashA + " a.go")},
+		{"bad submodule", z("1 .M X... 100644 100644 100644 " + hashA + " " + hashA + " a.go")},
+		{"short submodule", z("1 .M S.. 100644 100644 100644 " + hashA + " " + hashA + " a.go")},
+		{"bad ahead", z("# branch.ab +x -1")},
+		{"short branch.ab", z("# branch.ab +1")},
+		{"bad stash", z("# stash many")},
+		{"short header", z("# branch.head")},
+		{"unknown record", z("3 what")},
+	}
+	for _, tt := range tests {
+		if s, err := Parse(tt.in); err == nil {
+			t.Errorf("%s: Parse(%q) = %+v, want an error", tt.name, tt.in, s)
+		}
+	}
+}
+
+// run git in dir, returning its output and failing the test if it fails,
+// unless mayFail is set as for a merge that stops on conflicts
+func git(t *testing.T, dir string, mayFail bool, args ...string) string {
+	t.Helper()
+	args = append([]string{"-c", "user.name=gitwin", "-c", "user.email=gitwin@example.com",
+		"-c", "commit.gpgsign=false", "-c", "protocol.file.allow=always"}, args...)
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	out, err := cmd.CombinedOutput()
+	if err != nil && !mayFail {
+		t.Fatalf("git %s: %v\n%s", strings.Join(args, " "), err, out)
+	}
+	return strings.TrimSpace(string(out))
+}
+
+// write files relative to dir, creating their directories
+func write(t *testing.T, dir string, files ...string) {
+	t.Helper()
+	for i := 0; i < len(files); i += 2 {
+		p := filepath.Join(dir, files[i])
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(files[i+1]), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// a repo on branch main with files committed to it
+func newRepo(t *testing.T, files ...string) string {
+	t.Helper()
+	dir := t.TempDir()
+	git(t, dir, false, "init", "-q", "-b", "main")
+	write(t, dir, files...)
+	git(t, dir, false, "add", ".")
+	git(t, dir, false, "commit", "-q", "-m", "first")
+	return dir
+}
+
+// parse what git itself says about repos in the states gitwin has to show
+func TestParseGit(t *testing.T) {
+	tests := []struct {
+		name string
+		// sets up a repo and says what git status should report for it,
+		// less the branch header that's the same for all of them
+		setup func(t *testing.T) (string, *Status)
+	}{
+		{
+			name: "rename",
+			setup: func(t *testing.T) (string, *Status) {
+				dir := newRepo(t, "old name.go", "package a\n")
+				git(t, dir, false, "mv", "old name.go", "new name.go")
+				blob := git(t, dir, false, "rev-parse", ":new name.go")
+				return dir, &Status{Renamed: []Renamed{{
+					Changed:  Changed{XY: "R.", ModeHead: "100644", ModeIndex: "100644", ModeWorktree: "100644", HashHead: blob, HashIndex: blob, Path: "new name.go"},
+					Score:    "R100",
+					OrigPath: "old name.go",
+				}}}
+			},
+		},
+		{
+			name: "merge conflict",
+			setup: func(t *testing.T) (string, *Status) {
+				dir := newRepo(t, "f.txt", "base\n")
+				git(t, dir, false, "checkout", "-q", "-b", "other")
+				write(t, dir, "f.txt", "theirs\n")
+				git(t, dir, false, "commit", "-q", "-am", "theirs")
+				git(t, dir, false, "checkout", "-q", "main")
+				write(t, dir, "f.txt", "ours\n")
+				git(t, dir, false, "commit", "-q", "-am", "ours")
+				git(t, dir, true, "merge", "other")
+				return dir, &Status{Unmerged: []Unmerged{{
+					XY:           "UU",
+					ModeStage1:   "100644",
+					ModeStage2:   "100644",
+					ModeStage3:   "100644",
+					ModeWorktree: "100644",
+					HashStage1:   git(t, dir, false, "rev-parse", ":1:f.txt"),
+					HashStage2:   git(t, dir, false, "rev-parse", ":2:f.txt"),
+					HashStage3:   git(t, dir, false, "rev-parse", ":3:f.txt"),
+					Path:         "f.txt",
+				}}}
+			},
+		},
+		{
+			name: "dirty submodule",
+			setup: func(t *testing.T) (string, *Status) {
+				sub := newRepo(t, "lib.go", "package lib\n")
+				dir := newRepo(t, "main.go", "package main\n")
+				git(t, dir, false, "submodule", "add", "-q", sub, "lib/dirty")
+				git(t, dir, false, "commit", "-q", "-m", "add lib")
+				write(t, dir, "lib/dirty/lib.go", "package lib // changed\n")
+				head := git(t, sub, false, "rev-parse", "HEAD")
+				return dir, &Status{Changed: []Changed{{
+					XY:           ".M",
+					Sub:          Submodule{IsSubmodule: true, Modified: true},
+					ModeHead:     "160000",
+					ModeIndex:    "160000",
+					ModeWorktree: "160000",
+					HashHead:     head,
+					HashIndex:    head,
+					Path:         "lib/dirty",
+				}}}
+			},
+		},
+		{
+			name: "paths with spaces",
+			setup: func(t *testing.T) (string, *Status) {
+				dir := newRepo(t, "dir with spaces/a file.go", "package a\n")
+				blob := git(t, dir, false, "rev-parse", ":dir with spaces/a file.go")
+				write(t, dir, "dir with spaces/a file.go", "package b\n", "new file.txt", "new\n", "two  spaces", "")
+				git(t, dir, false, "add", "new file.txt")
+				return dir, &Status{
+					Changed: []Changed{
+						{XY: ".M", ModeHead: "100644", ModeIndex: "100644", ModeWorktree: "100644", HashHead: blob, HashIndex: blob, Path: "dir with spaces/a file.go"},
+						{XY: "A.", ModeHead: "000000", ModeIndex: "100644", ModeWorktree: "100644", HashHead: zero, HashIndex: git(t, dir, false, "rev-parse", ":new file.txt"), Path: "new file.txt"},
+					},
+					Untracked: []string{"two  spaces"},
+				}
+			},
+		},
+		{
+			name: "ignored",
+			setup: func(t *testing.T) (string, *Status) {
+				dir := newRepo(t, ".gitignore", "build/\n*.o\n")
+				write(t, dir, "build/out", "", "with space.o", "", "a.go", "")
+				return dir, &Status{Untracked: []string{"a.go"}, Ignored: []string{"build/", "with space.o"}}
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir, want := tt.setup(t)
+			out := git(t, dir, false, "status", "--porcelain=v2", "-z", "--branch", "--show-stash", "--ignored")
+			got, err := Parse([]byte(out))
+			if err != nil {
+				t.Fatalf("Parse: %v\n%q", err, out)
+			}
+			want.Branch = Branch{OID: git(t, dir, false, "rev-parse", "HEAD"), Head: "main"}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("Parse(%q) =\n%+v\nwant\n%+v", out, got, want)
+			}
+		})
+	}
+}
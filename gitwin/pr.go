@@ -0,0 +1,217 @@
+// pull request commands: opening one for the current branch, the +prs list,
+// checking a pull request out and its review comments as file addresses
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// a pull request number, with or without a leading #
+func prNumber(arg string) (int, error) {
+	n, err := strconv.Atoi(strings.TrimPrefix(strings.TrimSpace(arg), "#"))
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("bad pull request number %q", arg)
+	}
+	return n, nil
+}
+
+// PRCreate [base] opens a pull request for the current branch against base,
+// the main branch by default, titled from the last commit message
+func (h *handler) ExecPRCreate(cmd string) error {
+	f, err := h.forge()
+	if err != nil {
+		return err
+	}
+	status, err := h.gitPorcelain()
+	if err != nil {
+		return err
+	}
+	if status.Branch.Detached() {
+		return errors.New("HEAD is detached, check out a branch first")
+	}
+	if status.Branch.Upstream == "" {
+		return fmt.Errorf("%s has no upstream, Push it first", status.Branch.Head)
+	}
+	base := strings.TrimSpace(cmd)
+	if base == "" {
+		base = h.getMainName()
+	}
+	out, err := gitOutput(h.path, "log", "-1", "--format=%B")
+	if err != nil {
+		return err
+	}
+	title, body, _ := strings.Cut(strings.TrimSpace(string(out)), "\n")
+	head, err := h.prHead(status.Branch.Head)
+	if err != nil {
+		return err
+	}
+	// the forge can be slow, so this goes in the background like a push
+	var pr *pullRequest
+	return h.background("open pull request for "+head, func(ctx context.Context) error {
+		var err error
+		pr, err = f.CreatePR(ctx, head, base, title, strings.TrimSpace(body))
+		return err
+	}, func(err error) {
+		if err != nil {
+			return
+		}
+		fmt.Fprintf(&h.buf, "opened #%d %s\n\t%s\n\tPRComments %d\n\n", pr.number, pr.title, pr.url, pr.number)
+		h.ExecGet("")
+	})
+}
+
+// the head to open a pull request from for a local branch: the branch it
+// tracks, which may be named differently, as owner:branch when it's pushed
+// to a fork rather than to the forge's remote
+func (h *handler) prHead(branch string) (string, error) {
+	remote, err := gitOutput(h.path, "config", "--get", "branch."+branch+".remote")
+	if err != nil {
+		return "", fmt.Errorf("%s has no upstream, Push it first", branch)
+	}
+	merge, err := gitOutput(h.path, "config", "--get", "branch."+branch+".merge")
+	if err != nil {
+		return "", fmt.Errorf("%s has no upstream, Push it first", branch)
+	}
+	head := strings.TrimPrefix(strings.TrimSpace(string(merge)), "refs/heads/")
+	name := strings.TrimSpace(string(remote))
+	if name == h.config().remote {
+		return head, nil
+	}
+	u, err := gitOutput(h.path, "remote", "get-url", name)
+	if err != nil {
+		return "", err
+	}
+	_, owner, _, err := parseRemoteURL(string(u))
+	if err != nil {
+		return "", err
+	}
+	return owner + ":" + head, nil
+}
+
+// PRCheckout n fetches a pull request into a pr/n branch and checks it out
+func (h *handler) ExecPRCheckout(cmd string) error {
+	n, err := prNumber(cmd)
+	if err != nil {
+		return err
+	}
+	// fetched only as far as FETCH_HEAD, so that checkout moves pr/n and
+	// the worktree together even when pr/n is checked out already
+	branch := fmt.Sprintf("pr/%d", n)
+	return h.gitAsync(func(err error) {
+		if err != nil {
+			return
+		}
+		h.git("checkout", "-B", branch, "FETCH_HEAD")
+		h.ExecGet("")
+		h.repoWindows("get")
+	}, "fetch", h.config().remote, fmt.Sprintf("refs/pull/%d/head", n))
+}
+
+// state for the +prs window
+type prsWin struct {
+	*childWin
+}
+
+// PRs lists the repo's open pull requests
+func (h *handler) ExecPRs(cmd string) error {
+	c, err := h.newChild("+prs", "Get ")
+	if err != nil {
+		return err
+	}
+	pw := &prsWin{childWin: c}
+	go func() {
+		pw.ExecGet("")
+		runEvents(c.w, pw)
+	}()
+	return nil
+}
+
+func (pw *prsWin) ExecGet(cmd string) {
+	f, err := pw.repo.forge()
+	if err != nil {
+		fmt.Fprintln(&pw.buf, err)
+		pw.flush()
+		return
+	}
+	prs, err := f.ListPRs(context.Background())
+	if err != nil {
+		fmt.Fprintln(&pw.buf, err)
+		pw.flush()
+		return
+	}
+	if len(prs) == 0 {
+		fmt.Fprintln(&pw.buf, "no open pull requests")
+	}
+	for _, pr := range prs {
+		fmt.Fprintf(&pw.buf, "#%d\t%s\n\t%s -> %s by %s\t%s\n", pr.number, pr.title, pr.head, pr.base, pr.author, pr.url)
+		fmt.Fprintf(&pw.buf, "\tPRCheckout %d\tPRComments %d\n", pr.number, pr.number)
+	}
+	pw.flush()
+}
+
+func (pw *prsWin) ExecPRCheckout(cmd string) error {
+	return pw.repo.command(func() error { return pw.repo.ExecPRCheckout(cmd) })
+}
+
+func (pw *prsWin) ExecPRComments(cmd string) error {
+	return pw.repo.ExecPRComments(cmd)
+}
+
+// state for a +pr/<n> window
+type prWin struct {
+	*childWin
+	number int
+}
+
+// PRComments n lists a pull request's review comments by file and line
+func (h *handler) ExecPRComments(cmd string) error {
+	n, err := prNumber(cmd)
+	if err != nil {
+		return err
+	}
+	c, err := h.newChild(fmt.Sprintf("+pr/%d", n), "Get ")
+	if err != nil {
+		return err
+	}
+	pw := &prWin{childWin: c, number: n}
+	go func() {
+		pw.ExecGet("")
+		runEvents(c.w, pw)
+	}()
+	return nil
+}
+
+// each comment under a /path/to/file:line address, for Look
+func (pw *prWin) ExecGet(cmd string) {
+	f, err := pw.repo.forge()
+	if err != nil {
+		fmt.Fprintln(&pw.buf, err)
+		pw.flush()
+		return
+	}
+	comments, err := f.ReviewComments(context.Background(), pw.number)
+	if err != nil {
+		fmt.Fprintln(&pw.buf, err)
+		pw.flush()
+		return
+	}
+	fmt.Fprintf(&pw.buf, "review comments on #%d\n\n", pw.number)
+	if len(comments) == 0 {
+		fmt.Fprintln(&pw.buf, "none")
+	}
+	for _, c := range comments {
+		path := filepath.Join(pw.repo.path, c.path)
+		if c.line > 0 {
+			fmt.Fprintf(&pw.buf, "%s:%d\n", path, c.line)
+		} else {
+			fmt.Fprintf(&pw.buf, "%s\t(outdated)\n", path)
+		}
+		fmt.Fprintf(&pw.buf, "\t%s: %s\n", c.author, strings.ReplaceAll(strings.TrimSpace(c.body), "\n", "\n\t"))
+	}
+	pw.flush()
+}
@@ -0,0 +1,173 @@
+// interactive rebases: the todo list is edited in a +rebase window, then git
+// runs gitwin itself as its sequence editor (to hand over the edited todo)
+// and as its editor (to open reword/squash messages in +commit windows)
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// the commands git accepts in a rebase todo list
+var todoCommands = map[string]bool{
+	"pick": true, "p": true, "reword": true, "r": true, "edit": true, "e": true,
+	"squash": true, "s": true, "fixup": true, "f": true, "exec": true, "x": true,
+	"break": true, "b": true, "drop": true, "d": true, "label": true, "l": true,
+	"reset": true, "t": true, "merge": true, "m": true, "update-ref": true,
+}
+
+// state for a +rebase window
+type rebaseWin struct {
+	*childWin
+	base string
+}
+
+// RebaseI base opens the todo list for rebasing onto base in a +rebase window
+func (h *handler) ExecRebaseI(cmd string) error {
+	base := strings.TrimSpace(cmd)
+	if base == "" {
+		return errors.New("usage: RebaseI base")
+	}
+	c, err := h.newChild("+rebase", "Put Get ")
+	if err != nil {
+		return err
+	}
+	rw := &rebaseWin{childWin: c, base: base}
+	go func() {
+		rw.ExecGet("")
+		runEvents(c.w, rw)
+	}()
+	return nil
+}
+
+// write the default todo list, every commit since base as a pick
+func (rw *rebaseWin) ExecGet(cmd string) {
+	out, err := gitOutput(rw.repo.path, "log", "--reverse", "--no-merges", "--format=pick %h %s", rw.base+"..HEAD")
+	if err != nil {
+		fmt.Fprintln(&rw.buf, err)
+		rw.flush()
+		return
+	}
+	rw.buf.Write(out)
+	fmt.Fprintf(&rw.buf, "\n# Rebase onto %s. Reorder the lines above and change pick to\n", rw.base)
+	fmt.Fprintln(&rw.buf, "# reword, edit, squash, fixup or drop, then Put to start the rebase.")
+	fmt.Fprintln(&rw.buf, "# Reword and squash messages open in +commit windows, Put those to carry on.")
+	rw.flush()
+}
+
+// the todo list in the window, checked for unknown commands
+func (rw *rebaseWin) todo() (string, error) {
+	body, err := rw.w.ReadAll("body")
+	if err != nil {
+		return "", err
+	}
+	var lines []string
+	for _, line := range strings.Split(string(body), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		verb, _, _ := strings.Cut(line, " ")
+		if !todoCommands[verb] {
+			return "", fmt.Errorf("unknown rebase command %q in %q", verb, line)
+		}
+		lines = append(lines, line)
+	}
+	if len(lines) == 0 {
+		return "", errors.New("empty todo list, nothing to rebase")
+	}
+	return strings.Join(lines, "\n") + "\n", nil
+}
+
+// quote s for sh, which git uses to run its editors
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// the environment that makes git edit commit messages in +commit windows,
+// for a rebase and anything that continues it
+func editorEnv() ([]string, error) {
+	self, err := os.Executable()
+	if err != nil {
+		return nil, err
+	}
+	return []string{"GIT_EDITOR=" + shellQuote(self) + " -editor"}, nil
+}
+
+// start the rebase with the todo list from the window
+func (rw *rebaseWin) ExecPut(cmd string) error {
+	todo, err := rw.todo()
+	if err != nil {
+		return err
+	}
+	self, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	env, err := editorEnv()
+	if err != nil {
+		return err
+	}
+	f, err := os.CreateTemp("", "gitwin-todo")
+	if err != nil {
+		return err
+	}
+	_, err = f.WriteString(todo)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	env = append(env, "GIT_SEQUENCE_EDITOR="+shellQuote(self)+" -todo "+shellQuote(f.Name()))
+	err = rw.repo.command(func() error {
+		return rw.repo.gitAsyncEnv(env, func(err error) {
+			os.Remove(f.Name())
+			rw.repo.repoWindows("get")
+			rw.repo.checkConflicts()
+			if err == nil {
+				rw.w.Del(true)
+			}
+		}, "rebase", "-i", rw.base)
+	})
+	if err != nil {
+		os.Remove(f.Name())
+	}
+	return err
+}
+
+// gitwin -todo todofile path: git's sequence editor, replaces the todo list
+// git wrote at path with the one from the +rebase window
+func runSequenceEditor(todoFile, path string) error {
+	todo, err := os.ReadFile(todoFile)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, todo, 0644)
+}
+
+// gitwin -editor path: git's editor, opens the message in a +commit window
+// and waits for it to be Put (or deleted, which keeps git's message)
+func runMessageEditor(path string) error {
+	msg, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	dir, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+	h := &handler{path: dir}
+	c, err := h.newChild("+commit", "Put ")
+	if err != nil {
+		return err
+	}
+	cw := &composeWin{childWin: c, file: path}
+	cw.buf.Write(msg)
+	cw.flush()
+	runEvents(c.w, cw)
+	return nil
+}
@@ -0,0 +1,151 @@
+// the repository interface the windows render from, so the git binary can be
+// swapped for go-git with -backend. anything not covered here still runs git.
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/schultzor/acmeutil/gitwin/porcelain"
+)
+
+// what -backend accepts
+const (
+	backendExec  = "exec"
+	backendGoGit = "go-git"
+)
+
+// filters for repository.Log
+type logQuery struct {
+	count   int
+	since   string // a date, or for the exec backend anything git understands
+	author  string
+	path    string
+	grep    string // commit messages matching this regexp
+	pickaxe string // commits changing how often this string appears
+}
+
+type logEntry struct {
+	hash    string // abbreviated
+	author  string
+	date    string // YYYY-MM-DD
+	subject string
+}
+
+type repository interface {
+	Status() (*porcelain.Status, error)
+	Log(q logQuery) ([]logEntry, error)
+	Branches() ([]branch, error)
+	// unified diff of the worktree against the index, or of the index
+	// against HEAD when staged is set, limited to paths if there are any
+	Diff(staged bool, paths ...string) ([]byte, error)
+	Add(paths ...string) error
+	// commit what's staged, or with all every change to tracked files,
+	// returning a summary of the new commit
+	Commit(msg string, all bool) (string, error)
+}
+
+func newRepository(backend, dir string) (repository, error) {
+	switch backend {
+	case backendExec, "":
+		return execRepo{dir: dir}, nil
+	case backendGoGit:
+		return openGoGitRepo(dir)
+	}
+	return nil, fmt.Errorf("unknown backend %q, want %s or %s", backend, backendExec, backendGoGit)
+}
+
+// the repository, by running git
+type execRepo struct {
+	dir string
+}
+
+func (r execRepo) Status() (*porcelain.Status, error) {
+	out, err := gitOutput(r.dir, "status", "--branch", "--porcelain=v2", "-z", "-uall", "--show-stash")
+	if err != nil {
+		return nil, err
+	}
+	return porcelain.Parse(out)
+}
+
+func (r execRepo) Log(q logQuery) ([]logEntry, error) {
+	args := []string{"log", "--date=short", "--format=%h%x00%an%x00%ad%x00%s", "-n", strconv.Itoa(q.count)}
+	if q.since != "" {
+		args = append(args, "--since="+q.since)
+	}
+	if q.author != "" {
+		args = append(args, "--author="+q.author)
+	}
+	if q.grep != "" {
+		args = append(args, "--grep="+q.grep)
+	}
+	if q.pickaxe != "" {
+		args = append(args, "-S"+q.pickaxe)
+	}
+	if q.path != "" {
+		args = append(args, "--", q.path)
+	}
+	out, err := gitOutput(r.dir, args...)
+	if err != nil {
+		return nil, err
+	}
+	var entries []logEntry
+	for _, line := range strings.Split(strings.TrimSpace(string(out)), "\n") {
+		f := strings.Split(line, "\x00")
+		if len(f) == 4 {
+			entries = append(entries, logEntry{hash: f[0], author: f[1], date: f[2], subject: f[3]})
+		}
+	}
+	return entries, nil
+}
+
+func (r execRepo) Branches() ([]branch, error) {
+	out, err := gitOutput(r.dir, "for-each-ref",
+		"--format=%(refname)%00%(upstream:short)%00%(upstream:track)%00%(committerdate:short)%00%(objectname:short)%00%(HEAD)",
+		"refs/heads", "refs/remotes")
+	if err != nil {
+		return nil, err
+	}
+	var bs []branch
+	for _, line := range strings.Split(strings.TrimSpace(string(out)), "\n") {
+		f := strings.Split(line, "\x00")
+		if len(f) != 6 || strings.HasSuffix(f[0], "/HEAD") {
+			continue
+		}
+		b := branch{upstream: f[1], track: f[2], date: f[3], hash: f[4], head: f[5] == "*"}
+		if name, ok := strings.CutPrefix(f[0], "refs/heads/"); ok {
+			b.name = name
+		} else {
+			b.name, b.remote = strings.TrimPrefix(f[0], "refs/remotes/"), true
+		}
+		bs = append(bs, b)
+	}
+	return bs, nil
+}
+
+func (r execRepo) Diff(staged bool, paths ...string) ([]byte, error) {
+	args := []string{"diff", "--no-color", "--no-ext-diff", "--src-prefix=a/", "--dst-prefix=b/"}
+	if staged {
+		args = append(args, "--cached")
+	}
+	return gitOutput(r.dir, append(append(args, "--"), paths...)...)
+}
+
+func (r execRepo) Add(paths ...string) error {
+	_, err := gitOutput(r.dir, append([]string{"add", "--"}, paths...)...)
+	return err
+}
+
+func (r execRepo) Commit(msg string, all bool) (string, error) {
+	args := []string{"commit", "-m", msg}
+	if all {
+		args = append(args, "-a")
+	}
+	// commit reports problems like "nothing to commit" on stdout
+	out, err := execGit(r.dir, nil, true, args...)
+	if err != nil {
+		return "", fmt.Errorf("%v\n%s", err, out)
+	}
+	return string(out), nil
+}
@@ -0,0 +1,84 @@
+// searching: +grep windows for the tracked files, and log windows for
+// commits by message or by the changes they made
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// state for a +grep window
+type grepWin struct {
+	*childWin
+	pattern string
+}
+
+// Grep pattern searches the tracked files Ls lists
+func (h *handler) ExecGrep(cmd string) error {
+	pattern := strings.TrimSpace(cmd)
+	if pattern == "" {
+		return errors.New("usage: Grep pattern")
+	}
+	c, err := h.newChild("+grep", "Get ")
+	if err != nil {
+		return err
+	}
+	gw := &grepWin{childWin: c, pattern: pattern}
+	go func() {
+		gw.ExecGet("")
+		runEvents(c.w, gw)
+	}()
+	return nil
+}
+
+// each match as /path/to/file:line, then the line after a tab, so Look on
+// the address opens the file there
+func (gw *grepWin) ExecGet(cmd string) {
+	out, err := gitOutput(gw.repo.path, "grep", "-n", "-I", "--full-name", "-e", gw.pattern)
+	fmt.Fprintf(&gw.buf, "matches for %s\n\n", gw.pattern)
+	switch {
+	case err != nil && len(out) == 0:
+		// grep exits 1 when nothing matches
+		var ge *gitError
+		if errors.As(err, &ge) && strings.TrimSpace(ge.stderr) != "" {
+			fmt.Fprintln(&gw.buf, err)
+		} else {
+			fmt.Fprintln(&gw.buf, "no matches")
+		}
+	default:
+		cfg := gw.repo.config()
+		scanner := bufio.NewScanner(bytes.NewReader(out))
+		scanner.Buffer(nil, 1024*1024)
+		for scanner.Scan() {
+			path, rest, _ := strings.Cut(scanner.Text(), ":")
+			if !cfg.listed(path) {
+				continue
+			}
+			line, text, _ := strings.Cut(rest, ":")
+			fmt.Fprintf(&gw.buf, "%s:%s\t%s\n", filepath.Join(gw.repo.path, path), line, text)
+		}
+	}
+	gw.flush()
+}
+
+// Pickaxe string lists the commits that add or remove string
+func (h *handler) ExecPickaxe(cmd string) error {
+	s := strings.TrimSpace(cmd)
+	if s == "" {
+		return errors.New("usage: Pickaxe string")
+	}
+	return h.openLog(&logWin{pickaxe: s})
+}
+
+// LogGrep text lists the commits with messages matching text
+func (h *handler) ExecLogGrep(cmd string) error {
+	s := strings.TrimSpace(cmd)
+	if s == "" {
+		return errors.New("usage: LogGrep text")
+	}
+	return h.openLog(&logWin{grep: s})
+}
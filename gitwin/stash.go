@@ -0,0 +1,99 @@
+// stash commands and the +stashes list window
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Stash [-u] [message] stashes the changes to tracked files, and with -u
+// untracked files as well
+func (h *handler) ExecStash(cmd string) {
+	args := []string{"stash", "push"}
+	msg := strings.TrimSpace(cmd)
+	if f := strings.Fields(msg); len(f) > 0 && f[0] == "-u" {
+		args = append(args, "--include-untracked")
+		msg = strings.TrimSpace(strings.TrimPrefix(msg, "-u"))
+	}
+	if msg != "" {
+		args = append(args, "-m", msg)
+	}
+	h.git(args...)
+	h.repoWindows("get")
+	h.ExecGet("")
+}
+
+// state for a +stashes window
+type stashWin struct {
+	*childWin
+}
+
+func (h *handler) ExecStashes(cmd string) error {
+	c, err := h.newChild("+stashes", "Get ")
+	if err != nil {
+		return err
+	}
+	sw := &stashWin{childWin: c}
+	go func() {
+		sw.ExecGet("")
+		runEvents(c.w, sw)
+	}()
+	return nil
+}
+
+func (sw *stashWin) ExecGet(cmd string) {
+	var list strings.Builder
+	if err := runGit(sw.repo.path, nil, &list, "stash", "list", "--format=%gd\t%cr\t%gs"); err != nil {
+		sw.buf.WriteString(list.String())
+		sw.flush()
+		return
+	}
+	if list.Len() == 0 {
+		sw.buf.WriteString("no stashes\n")
+	}
+	for _, line := range strings.Split(strings.TrimSpace(list.String()), "\n") {
+		if line == "" {
+			continue
+		}
+		ref, _, _ := strings.Cut(line, "\t")
+		fmt.Fprintf(&sw.buf, "%s\n\tApply %s\tPop %s\tDrop %s\tShow %s\n", line, ref, ref, ref, ref)
+	}
+	sw.flush()
+}
+
+// run a stash subcommand on ref, the output goes to the status window
+func (sw *stashWin) run(sub, ref string) error {
+	if ref == "" {
+		return fmt.Errorf("no stash given for %s, expected stash@{n}", sub)
+	}
+	return sw.repo.command(func() error {
+		sw.repo.git("stash", sub, ref)
+		if sub != "drop" {
+			sw.repo.repoWindows("get")
+		}
+		sw.repo.ExecGet("")
+		sw.repo.checkConflicts()
+		sw.ExecGet("")
+		return nil
+	})
+}
+
+func (sw *stashWin) ExecApply(ref string) error {
+	return sw.run("apply", ref)
+}
+
+func (sw *stashWin) ExecPop(ref string) error {
+	return sw.run("pop", ref)
+}
+
+func (sw *stashWin) ExecDrop(ref string) error {
+	return sw.run("drop", ref)
+}
+
+func (sw *stashWin) ExecShow(ref string) error {
+	if ref == "" {
+		return errors.New("usage: Show stash@{n}")
+	}
+	return sw.repo.showDiff("+stash/"+ref, "stash", "show", "--no-color", "-p", "--src-prefix=a/", "--dst-prefix=b/", "--include-untracked", ref)
+}
@@ -0,0 +1,71 @@
+// submodules: how they show up in the status and the commands for them
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+
+	"github.com/schultzor/acmeutil/gitwin/porcelain"
+)
+
+// what's changed in a submodule, from its porcelain sub field
+func describeSubmodule(s porcelain.Submodule) string {
+	var what []string
+	if s.CommitChanged {
+		what = append(what, "new commits")
+	}
+	if s.Modified {
+		what = append(what, "modified content")
+	}
+	if s.Untracked {
+		what = append(what, "untracked content")
+	}
+	if len(what) == 0 {
+		return "unchanged"
+	}
+	return strings.Join(what, ", ")
+}
+
+// a changed submodule and what can be done about it. only a moved HEAD can
+// be staged here, changes inside the submodule need committing in it first
+func formatSubmodule(w io.Writer, x porcelain.Changed) {
+	fmt.Fprintf(w, "\t%s: %s\n", x.Path, describeSubmodule(x.Sub))
+	var cmds []string
+	if x.Unstaged() && x.Sub.CommitChanged {
+		cmds = append(cmds, "Add "+x.Path)
+	}
+	if x.Staged() {
+		cmds = append(cmds, "Unstage "+x.Path)
+	}
+	cmds = append(cmds, "SubOpen "+x.Path, "SubUpdate "+x.Path, "SubSync "+x.Path)
+	fmt.Fprintf(w, "\t\t%s\n", strings.Join(cmds, "\t"))
+	if x.Sub.Modified || x.Sub.Untracked {
+		fmt.Fprintf(w, "\t\tcommit inside %s (SubOpen) before adding it here\n", x.Path)
+	}
+}
+
+// SubUpdate [path ...] checks out the recorded commit of submodules, in the background
+func (h *handler) ExecSubUpdate(cmd string) error {
+	args := append([]string{"submodule", "update", "--init", "--recursive", "--"}, strings.Fields(cmd)...)
+	return h.gitAsync(func(error) {
+		h.repoWindows("get")
+	}, args...)
+}
+
+// SubSync [path ...] copies submodule urls from .gitmodules into the config
+func (h *handler) ExecSubSync(cmd string) {
+	h.git(append([]string{"submodule", "sync", "--recursive", "--"}, strings.Fields(cmd)...)...)
+	h.ExecGet("")
+}
+
+// SubOpen path opens a +git window for a submodule
+func (h *handler) ExecSubOpen(cmd string) error {
+	path := strings.TrimSpace(cmd)
+	if path == "" {
+		return errors.New("usage: SubOpen path")
+	}
+	return openRepo(filepath.Join(h.path, path))
+}
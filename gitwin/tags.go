@@ -0,0 +1,253 @@
+// tags and releases: the +tags window, tagging, and working out the next version
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"golang.org/x/mod/semver"
+)
+
+type tag struct {
+	name      string
+	date      string
+	hash      string // of the commit tagged
+	annotated bool
+	subject   string // of the annotation, or of the commit for lightweight tags
+}
+
+// list tags, highest semver first, then any non-semver tags by name
+func (h *handler) tags(args ...string) ([]tag, error) {
+	args = append([]string{"for-each-ref",
+		"--format=%(refname:short)%00%(creatordate:short)%00%(objecttype)%00%(objectname:short)%00%(*objectname:short)%00%(contents:subject)",
+		"refs/tags"}, args...)
+	out, err := gitOutput(h.path, args...)
+	if err != nil {
+		return nil, err
+	}
+	var ts []tag
+	for _, line := range strings.Split(strings.TrimSpace(string(out)), "\n") {
+		f := strings.Split(line, "\x00")
+		if len(f) != 6 {
+			continue
+		}
+		hash := f[3]
+		if f[2] == "tag" {
+			// an annotated tag points at a tag object, which points at the commit
+			hash = f[4]
+		}
+		ts = append(ts, tag{name: f[0], date: f[1], hash: hash, annotated: f[2] == "tag", subject: f[5]})
+	}
+	sort.SliceStable(ts, func(i, j int) bool {
+		vi, vj := semver.IsValid(ts[i].name), semver.IsValid(ts[j].name)
+		if vi != vj {
+			return vi
+		}
+		if vi {
+			return semver.Compare(ts[i].name, ts[j].name) > 0
+		}
+		return ts[i].name < ts[j].name
+	})
+	return ts, nil
+}
+
+// Tag name [message] tags HEAD, annotated if there's a message
+func (h *handler) ExecTag(cmd string) error {
+	name, msg, _ := strings.Cut(strings.TrimSpace(cmd), " ")
+	if name == "" {
+		return errors.New("usage: Tag name [message]")
+	}
+	args := []string{"tag", name}
+	if msg = strings.TrimSpace(msg); msg != "" {
+		args = []string{"tag", "-a", name, "-m", msg}
+	}
+	if h.git(args...) == nil {
+		fmt.Fprintf(&h.buf, "tagged HEAD as %s\n", name)
+	}
+	h.flush()
+	return nil
+}
+
+func (h *handler) ExecDeleteTag(cmd string) error {
+	names := strings.Fields(cmd)
+	if len(names) == 0 {
+		return errors.New("usage: DeleteTag name ...")
+	}
+	h.git(append([]string{"tag", "-d"}, names...)...)
+	h.flush()
+	return nil
+}
+
+// push all tags to the configured remote, in the background
+func (h *handler) ExecPushTags(cmd string) error {
+	return h.gitAsync(nil, "push", h.config().remote, "--tags")
+}
+
+// subjects like "feat: ..." or "feat(x): ...", and "fix!: ..." for breaking changes
+var conventionalRe = regexp.MustCompile(`^(\w+)(\([^)]*\))?(!)?:`)
+
+// work out the next release from the commits since the last semver tag
+// reachable from HEAD: a major bump for breaking changes (a minor one while
+// still at v0), a minor bump for features and a patch bump otherwise
+func (h *handler) nextVersion() (last string, bumps [3]string, pick int, n int, err error) {
+	ts, err := h.tags("--merged", "HEAD")
+	if err != nil {
+		return
+	}
+	rng := "HEAD"
+	for _, t := range ts {
+		if semver.IsValid(t.name) && semver.Prerelease(t.name) == "" {
+			last, rng = t.name, t.name+"..HEAD"
+			break
+		}
+	}
+	out, err := gitOutput(h.path, "log", "--format=%B%x00", rng)
+	if err != nil {
+		return
+	}
+	major, minor, patch := 0, 0, 0
+	if last != "" {
+		f := strings.Split(strings.TrimPrefix(semver.Canonical(last), "v"), ".")
+		major, _ = strconv.Atoi(f[0])
+		minor, _ = strconv.Atoi(f[1])
+		patch, _ = strconv.Atoi(f[2])
+	}
+	bumps = [3]string{
+		fmt.Sprintf("v%d.%d.%d", major, minor, patch+1),
+		fmt.Sprintf("v%d.%d.0", major, minor+1),
+		fmt.Sprintf("v%d.0.0", major+1),
+	}
+	if last == "" {
+		bumps[0] = "v0.1.0"
+	}
+	for _, msg := range strings.Split(string(out), "\x00") {
+		msg = strings.TrimSpace(msg)
+		if msg == "" {
+			continue
+		}
+		n++
+		m := conventionalRe.FindStringSubmatch(msg)
+		switch {
+		case strings.Contains(msg, "BREAKING CHANGE") || (m != nil && m[3] == "!"):
+			pick = max(pick, 2)
+		case m != nil && m[1] == "feat":
+			pick = max(pick, 1)
+		}
+	}
+	if pick == 2 && major == 0 {
+		pick = 1
+	}
+	return
+}
+
+// NextVersion proposes the next patch, minor and major tags
+func (h *handler) ExecNextVersion(cmd string) {
+	h.writeNextVersion(&h.buf)
+	h.flush()
+}
+
+func (h *handler) writeNextVersion(w io.Writer) {
+	last, bumps, pick, n, err := h.nextVersion()
+	if err != nil {
+		fmt.Fprintln(w, err)
+		return
+	}
+	if last == "" {
+		fmt.Fprintf(w, "no release tags yet, %d commits\n", n)
+	} else {
+		fmt.Fprintf(w, "%d commits since %s\n", n, last)
+	}
+	if n == 0 {
+		return
+	}
+	for i, v := range bumps {
+		mark := " "
+		if i == pick {
+			mark = "*"
+		}
+		fmt.Fprintf(w, "%s %s\tTag %s\n", mark, []string{"patch", "minor", "major"}[i], v)
+	}
+	if pick == 2 {
+		fmt.Fprintln(w, "  major versions from v2 on need a /vN suffix on the module path")
+	}
+}
+
+// state for a +tags window
+type tagsWin struct {
+	*childWin
+}
+
+func (h *handler) ExecTags(cmd string) error {
+	c, err := h.newChild("+tags", "Get NextVersion PushTags ")
+	if err != nil {
+		return err
+	}
+	tw := &tagsWin{childWin: c}
+	go func() {
+		tw.ExecGet("")
+		runEvents(c.w, tw)
+	}()
+	return nil
+}
+
+func (tw *tagsWin) ExecGet(cmd string) {
+	tw.writeTags()
+	tw.flush()
+}
+
+func (tw *tagsWin) writeTags() {
+	ts, err := tw.repo.tags()
+	if err != nil {
+		fmt.Fprintln(&tw.buf, err)
+		return
+	}
+	if len(ts) == 0 {
+		fmt.Fprintln(&tw.buf, "no tags")
+	}
+	for _, t := range ts {
+		kind := "lightweight"
+		if t.annotated {
+			kind = "annotated"
+		}
+		fmt.Fprintf(&tw.buf, "%s\t%s\t%s\t%s: %s\n", t.name, t.date, t.hash, kind, t.subject)
+		fmt.Fprintf(&tw.buf, "\tDeleteTag %s\n", t.name)
+	}
+}
+
+func (tw *tagsWin) Look(arg string) bool {
+	return tw.repo.lookCommit(arg)
+}
+
+func (tw *tagsWin) ExecDeleteTag(cmd string) error {
+	return tw.repo.command(func() error {
+		err := tw.repo.ExecDeleteTag(cmd)
+		tw.ExecGet("")
+		return err
+	})
+}
+
+func (tw *tagsWin) ExecTag(cmd string) error {
+	return tw.repo.command(func() error {
+		err := tw.repo.ExecTag(cmd)
+		tw.ExecGet("")
+		return err
+	})
+}
+
+func (tw *tagsWin) ExecPushTags(cmd string) error {
+	return tw.repo.command(func() error { return tw.repo.ExecPushTags("") })
+}
+
+// propose the next version above the tags, Tag lines in it tag HEAD. the
+// window is redrawn, so running it again replaces the proposal
+func (tw *tagsWin) ExecNextVersion(cmd string) {
+	tw.repo.writeNextVersion(&tw.buf)
+	tw.buf.WriteString("\n")
+	tw.writeTags()
+	tw.flush()
+}
@@ -0,0 +1,69 @@
+package main
+
+import "testing"
+
+func TestNextVersion(t *testing.T) {
+	type commit struct{ msg, tag string }
+	tests := []struct {
+		name    string
+		commits []commit
+		last    string
+		bumps   [3]string
+		pick, n int
+	}{
+		{
+			"no tags",
+			[]commit{{"first", ""}, {"fix: a thing", ""}},
+			"", [3]string{"v0.1.0", "v0.1.0", "v1.0.0"}, 0, 2,
+		},
+		{
+			"feature",
+			[]commit{{"first", "v1.4.2"}, {"fix: a", ""}, {"feat(ui): b", ""}},
+			"v1.4.2", [3]string{"v1.4.3", "v1.5.0", "v2.0.0"}, 1, 2,
+		},
+		{
+			"breaking at v0 is a minor bump",
+			[]commit{{"first", "v0.3.1"}, {"feat!: drop the old API", ""}},
+			"v0.3.1", [3]string{"v0.3.2", "v0.4.0", "v1.0.0"}, 1, 1,
+		},
+		{
+			"breaking change footer",
+			[]commit{{"first", "v2.0.0"}, {"refactor: x\n\nBREAKING CHANGE: y is gone", ""}},
+			"v2.0.0", [3]string{"v2.0.1", "v2.1.0", "v3.0.0"}, 2, 1,
+		},
+		{
+			"prereleases skipped",
+			[]commit{{"first", "v1.0.0"}, {"feat: a", "v1.1.0-rc.1"}, {"fix: b", ""}},
+			"v1.0.0", [3]string{"v1.0.1", "v1.1.0", "v2.0.0"}, 1, 2,
+		},
+		{
+			"short tag",
+			[]commit{{"first", "v1.2"}, {"chore: tidy", ""}},
+			"v1.2", [3]string{"v1.2.1", "v1.3.0", "v2.0.0"}, 0, 1,
+		},
+		{
+			"nothing since",
+			[]commit{{"first", "v1.0.0"}},
+			"v1.0.0", [3]string{"v1.0.1", "v1.1.0", "v2.0.0"}, 0, 0,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := testRepo(t)
+			for _, c := range tt.commits {
+				mustGit(t, dir, "commit", "-q", "--allow-empty", "-m", c.msg)
+				if c.tag != "" {
+					mustGit(t, dir, "tag", c.tag)
+				}
+			}
+			h := &handler{path: dir}
+			last, bumps, pick, n, err := h.nextVersion()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if last != tt.last || bumps != tt.bumps || pick != tt.pick || n != tt.n {
+				t.Errorf("nextVersion = %q %v %d %d, want %q %v %d %d", last, bumps, pick, n, tt.last, tt.bumps, tt.pick, tt.n)
+			}
+		})
+	}
+}
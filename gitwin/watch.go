@@ -0,0 +1,243 @@
+// refresh the +git window when the repo changes on disk, whoever changed it:
+// the worktree (minus anything ignored) and the bits of the git dir that
+// matter to the status (HEAD, index, refs) are watched with inotify, bursts
+// of events are coalesced, and the window is only redrawn if the status differs
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+const (
+	watchDelay = 300 * time.Millisecond // quiet time before refreshing
+	watchMax   = 2 * time.Second        // longest a steady stream of events can put a refresh off
+)
+
+// start watching the repo, returning a func to stop. if the watcher can't be
+// set up, or can't watch every directory, readLog carries on refreshing on
+// acme puts too
+func (h *handler) watch() (stop func()) {
+	w, err := fsnotify.NewWatcher()
+	if err != nil {
+		debugf("error creating watcher for %s: %v", h.path, err)
+		return func() {}
+	}
+	gitDir, err := h.gitDir()
+	if err != nil {
+		debugf("error finding git dir for %s: %v", h.path, err)
+		w.Close()
+		return func() {}
+	}
+	commonDir := gitDir
+	if out, err := gitOutput(h.path, "rev-parse", "--git-common-dir"); err == nil {
+		commonDir = strings.TrimSpace(string(out))
+		if !filepath.IsAbs(commonDir) {
+			commonDir = filepath.Join(h.path, commonDir)
+		}
+	}
+	err = h.addDirs(w, h.path, h.ignoredDirs())
+	for _, dir := range []string{gitDir, commonDir} {
+		if aerr := w.Add(dir); aerr != nil && err == nil {
+			err = fmt.Errorf("watching %s: %w", dir, aerr)
+		}
+	}
+	if aerr := h.addDirs(w, filepath.Join(commonDir, "refs"), nil); aerr != nil && err == nil {
+		err = aerr
+	}
+	if err != nil {
+		// e.g. out of inotify watches, the rest still refresh on changes
+		h.w.Errf("not watching all of %s, refreshing on put too: %v", h.path, err)
+	} else {
+		h.mu.Lock()
+		h.watching = true
+		h.mu.Unlock()
+	}
+	go h.watchLoop(w, []string{gitDir, commonDir}, h.refreshIfChanged)
+	return func() { w.Close() }
+}
+
+func (h *handler) isWatching() bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.watching
+}
+
+// directories git ignores, relative to the repo with a trailing slash
+func (h *handler) ignoredDirs() map[string]bool {
+	ignored := map[string]bool{}
+	out, err := gitOutput(h.path, "ls-files", "--others", "--ignored", "--exclude-standard", "--directory", "-z")
+	if err != nil {
+		debugf("error listing ignored dirs: %v", err)
+		return ignored
+	}
+	for _, p := range strings.Split(string(out), "\x00") {
+		if strings.HasSuffix(p, "/") {
+			ignored[p] = true
+		}
+	}
+	return ignored
+}
+
+// watch dir and everything under it, skipping .git and ignored directories,
+// returning the first directory that couldn't be watched
+func (h *handler) addDirs(w *fsnotify.Watcher, dir string, ignored map[string]bool) error {
+	var failed error
+	filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || !d.IsDir() {
+			return nil
+		}
+		if d.Name() == ".git" {
+			return filepath.SkipDir
+		}
+		if rel, err := filepath.Rel(h.path, path); err == nil && ignored[filepath.ToSlash(rel)+"/"] {
+			return filepath.SkipDir
+		}
+		if err := w.Add(path); err != nil && failed == nil {
+			failed = fmt.Errorf("watching %s: %w", path, err)
+		}
+		return nil
+	})
+	return failed
+}
+
+// go back to refreshing on puts after a new directory couldn't be watched
+func (h *handler) watchFailed(err error) {
+	h.mu.Lock()
+	was := h.watching
+	h.watching = false
+	h.mu.Unlock()
+	if was {
+		h.w.Errf("not watching all of %s, refreshing on put too: %v", h.path, err)
+	}
+}
+
+// whether a change in the git dir can change the status
+func gitDirChange(rel string) bool {
+	if strings.HasSuffix(rel, ".lock") {
+		return false
+	}
+	switch rel {
+	case "HEAD", "index", "packed-refs", "MERGE_HEAD", "CHERRY_PICK_HEAD", "REVERT_HEAD":
+		return true
+	}
+	return strings.HasPrefix(rel, "refs"+string(filepath.Separator))
+}
+
+// which of paths, relative to the repo, git doesn't ignore
+func (h *handler) notIgnored(paths map[string]bool) int {
+	var in bytes.Buffer
+	for p := range paths {
+		in.WriteString(p)
+		in.WriteByte(0)
+	}
+	// check-ignore exits 1 when nothing is ignored
+	out, _ := execGit(h.path, in.Bytes(), false, "check-ignore", "-z", "--stdin")
+	n := len(paths)
+	for _, p := range strings.Split(string(out), "\x00") {
+		if paths[p] {
+			n--
+		}
+	}
+	return n
+}
+
+// call refresh once a burst of relevant events is over
+func (h *handler) watchLoop(w *fsnotify.Watcher, gitDirs []string, refresh func()) {
+	var (
+		timer   <-chan time.Time
+		first   time.Time
+		changed = map[string]bool{} // worktree paths, relative to the repo
+		gitDir  bool                // whether anything relevant changed in the git dir
+	)
+	for {
+		select {
+		case ev, ok := <-w.Events:
+			if !ok {
+				return
+			}
+			if ev.Has(fsnotify.Chmod) {
+				continue
+			}
+			inGitDir := false
+			for _, dir := range gitDirs {
+				if rel, err := filepath.Rel(dir, ev.Name); err == nil && !strings.HasPrefix(rel, "..") {
+					inGitDir = true
+					if gitDirChange(rel) {
+						gitDir = true
+						if fi, err := os.Stat(ev.Name); err == nil && fi.IsDir() && ev.Has(fsnotify.Create) {
+							if err := h.addDirs(w, ev.Name, nil); err != nil {
+								h.watchFailed(err)
+							}
+						}
+					}
+					break
+				}
+			}
+			if !inGitDir {
+				rel, err := filepath.Rel(h.path, ev.Name)
+				if err != nil {
+					continue
+				}
+				changed[filepath.ToSlash(rel)] = true
+				if fi, err := os.Stat(ev.Name); err == nil && fi.IsDir() && ev.Has(fsnotify.Create) {
+					if err := h.addDirs(w, ev.Name, h.ignoredDirs()); err != nil {
+						h.watchFailed(err)
+					}
+				}
+			}
+			if len(changed) == 0 && !gitDir {
+				continue
+			}
+			if timer == nil {
+				first = time.Now()
+			}
+			if wait := watchMax - time.Since(first); wait < watchDelay {
+				timer = time.After(wait)
+			} else {
+				timer = time.After(watchDelay)
+			}
+		case err, ok := <-w.Errors:
+			if !ok {
+				return
+			}
+			debugf("watch error for %s: %v", h.path, err)
+		case <-timer:
+			if gitDir || h.notIgnored(changed) > 0 {
+				refresh()
+			}
+			timer, changed, gitDir = nil, map[string]bool{}, false
+		}
+	}
+}
+
+// redraw the +git window if the status isn't what it last showed, leaving
+// it alone while a background command is writing to it, and after, until a
+// Get or another command, so its output can be read
+func (h *handler) refreshIfChanged() {
+	h.winMu.Lock()
+	defer h.winMu.Unlock()
+	if h.showingOutput() || h.busy() != "" {
+		return
+	}
+	status, err := h.gitPorcelain()
+	if err != nil {
+		debugf("error getting status for %s: %v", h.path, err)
+		return
+	}
+	h.mu.Lock()
+	same := reflect.DeepEqual(status, h.shown)
+	h.mu.Unlock()
+	if !same {
+		debugf("status changed for %s, refreshing", h.path)
+		h.ExecGet("")
+	}
+}
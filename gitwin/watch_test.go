@@ -0,0 +1,148 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+func TestGitDirChange(t *testing.T) {
+	tests := []struct {
+		rel  string
+		want bool
+	}{
+		{"HEAD", true},
+		{"index", true},
+		{"packed-refs", true},
+		{"MERGE_HEAD", true},
+		{"CHERRY_PICK_HEAD", true},
+		{"REVERT_HEAD", true},
+		{filepath.Join("refs", "heads", "main"), true},
+		{filepath.Join("refs", "remotes", "origin", "main"), true},
+		{filepath.Join("refs", "stash"), true},
+		// written while git works, the rename onto the real file follows
+		{"index.lock", false},
+		{"HEAD.lock", false},
+		{filepath.Join("refs", "heads", "main.lock"), false},
+		{"refs", false},
+		{"ORIG_HEAD", false},
+		{"FETCH_HEAD", false},
+		{"COMMIT_EDITMSG", false},
+		{"logs", false},
+		{filepath.Join("logs", "HEAD"), false},
+		{filepath.Join("objects", "ab", "cdef"), false},
+		{"refsx", false},
+	}
+	for _, tt := range tests {
+		if got := gitDirChange(tt.rel); got != tt.want {
+			t.Errorf("gitDirChange(%q) = %v, want %v", tt.rel, got, tt.want)
+		}
+	}
+}
+
+func TestNotIgnored(t *testing.T) {
+	dir := testRepo(t)
+	writeFiles(t, dir, map[string]string{
+		".gitignore":     "*.o\nbuild/\n",
+		"sub/.gitignore": "local.txt\n",
+	})
+	h := &handler{path: dir}
+	tests := []struct {
+		name    string
+		changed []string
+		want    int
+	}{
+		{"none", nil, 0},
+		{"ignored only", []string{"a.o", "build/out", "sub/local.txt"}, 0},
+		{"not ignored", []string{"a.go", "sub/b.go"}, 2},
+		{"mixed", []string{"a.go", "a.o", "build/x", "sub/local.txt", "local.txt"}, 2},
+		{"ignore file itself", []string{".gitignore"}, 1},
+	}
+	for _, tt := range tests {
+		paths := map[string]bool{}
+		for _, p := range tt.changed {
+			paths[p] = true
+		}
+		if got := h.notIgnored(paths); got != tt.want {
+			t.Errorf("%s: notIgnored(%v) = %d, want %d", tt.name, tt.changed, got, tt.want)
+		}
+	}
+}
+
+func TestIgnoredDirs(t *testing.T) {
+	dir := testRepo(t)
+	writeFiles(t, dir, map[string]string{
+		".gitignore":     "build/\n*.o\n",
+		"build/out/a":    "",
+		"src/main.go":    "",
+		"src/main.o":     "",
+		"web/.gitignore": "cache/\n",
+		"web/cache/x.js": "",
+		"web/app.js":     "",
+	})
+	h := &handler{path: dir}
+	want := map[string]bool{"build/": true, "web/cache/": true}
+	if got := h.ignoredDirs(); !reflect.DeepEqual(got, want) {
+		t.Errorf("ignoredDirs = %v, want %v", got, want)
+	}
+}
+
+// bursts of changes make one refresh, ignored files and the git dir's
+// scratch files none
+func TestWatchLoop(t *testing.T) {
+	dir := testRepo(t)
+	writeFiles(t, dir, map[string]string{".gitignore": "*.o\nbuild/\n", "build/x": ""})
+	commitFile(t, dir, "a.go", "1")
+	h := &handler{path: dir}
+	w, err := fsnotify.NewWatcher()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	gitDir := filepath.Join(dir, ".git")
+	if err := h.addDirs(w, dir, h.ignoredDirs()); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Add(gitDir); err != nil {
+		t.Fatal(err)
+	}
+	refreshed := make(chan bool, 10)
+	go h.watchLoop(w, []string{gitDir}, func() { refreshed <- true })
+	// long enough for a burst to settle and its refresh to run
+	settle := func() int {
+		time.Sleep(watchDelay + 500*time.Millisecond)
+		n := 0
+		for {
+			select {
+			case <-refreshed:
+				n++
+			default:
+				return n
+			}
+		}
+	}
+
+	for i := 0; i < 5; i++ {
+		writeFiles(t, dir, map[string]string{"a.go": fmt.Sprint(i), "b.go": fmt.Sprint(i)})
+		time.Sleep(watchDelay / 10)
+	}
+	if n := settle(); n != 1 {
+		t.Errorf("a burst of worktree writes refreshed %d times, want 1", n)
+	}
+	writeFiles(t, dir, map[string]string{"a.o": "", "build/y": "", ".git/index.lock": "", ".git/FETCH_HEAD": ""})
+	if err := os.Remove(filepath.Join(gitDir, "index.lock")); err != nil {
+		t.Fatal(err)
+	}
+	if n := settle(); n != 0 {
+		t.Errorf("writing ignored files refreshed %d times, want 0", n)
+	}
+	mustGit(t, dir, "add", "a.go")
+	if n := settle(); n != 1 {
+		t.Errorf("updating the index refreshed %d times, want 1", n)
+	}
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+
+	"9fans.net/go/acme"
+)
+
+// state shared by the child windows a handler opens, e.g. +hunks
+type childWin struct {
+	repo *handler
+	w    *acme.Win
+	buf  bytes.Buffer
+}
+
+// create a new acme window named name in the repo dir, with tag appended to its tag line
+func (h *handler) newChild(name, tag string) (*childWin, error) {
+	w, err := acme.New()
+	if err != nil {
+		return nil, err
+	}
+	w.Name("%s/%s", h.path, name)
+	w.SetErrorPrefix(h.path + "/+git")
+	w.Write("tag", []byte(tag))
+	return &childWin{repo: h, w: w}, nil
+}
+
+// show the acme window for the file at path, opening a new one if needed
+func openFile(path string) (*acme.Win, error) {
+	if wins, err := acme.Windows(); err == nil {
+		for _, wi := range wins {
+			if wi.Name == path {
+				w, err := acme.Open(wi.ID, nil)
+				if err != nil {
+					return nil, err
+				}
+				w.Ctl("show")
+				return w, nil
+			}
+		}
+	}
+	w, err := acme.New()
+	if err != nil {
+		return nil, err
+	}
+	w.Name("%s", path)
+	w.Ctl("get")
+	return w, nil
+}
+
+// like handler.git, for the child window's body
+func (c *childWin) git(args ...string) error {
+	err := runGit(c.repo.path, nil, &c.buf, args...)
+	if err != nil {
+		fmt.Fprintln(&c.buf, err)
+	}
+	return err
+}
+
+func (c *childWin) flush() {
+	c.w.Clear()
+	c.w.Write("body", c.buf.Bytes())
+	c.w.Ctl("clean")
+	c.buf = bytes.Buffer{}
+}
+
+func (c *childWin) Look(arg string) bool {
+	return false
+}
+
+func (c *childWin) Execute(cmd string) bool {
+	return false
+}
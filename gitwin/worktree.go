@@ -0,0 +1,184 @@
+// worktree commands, each worktree gets its own +git window in this process
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+type worktree struct {
+	path     string
+	head     string
+	branch   string // empty when detached
+	bare     bool
+	locked   bool
+	prunable bool
+}
+
+// parse `git worktree list --porcelain`, entries are separated by blank lines
+func parseWorktrees(out string) []worktree {
+	var wts []worktree
+	for _, block := range strings.Split(strings.TrimSpace(out), "\n\n") {
+		var wt worktree
+		for _, line := range strings.Split(block, "\n") {
+			key, val, _ := strings.Cut(line, " ")
+			switch key {
+			case "worktree":
+				wt.path = val
+			case "HEAD":
+				wt.head = val
+			case "branch":
+				wt.branch = strings.TrimPrefix(val, "refs/heads/")
+			case "bare":
+				wt.bare = true
+			case "locked":
+				wt.locked = true
+			case "prunable":
+				wt.prunable = true
+			}
+		}
+		if wt.path != "" {
+			wts = append(wts, wt)
+		}
+	}
+	return wts
+}
+
+func (h *handler) worktrees() ([]worktree, error) {
+	out, err := gitOutput(h.path, "worktree", "list", "--porcelain")
+	if err != nil {
+		return nil, err
+	}
+	return parseWorktrees(string(out)), nil
+}
+
+// state for a +worktrees window
+type worktreeWin struct {
+	*childWin
+}
+
+func (h *handler) ExecWorktrees(cmd string) error {
+	c, err := h.newChild("+worktrees", "Get WorktreeAdd ")
+	if err != nil {
+		return err
+	}
+	ww := &worktreeWin{childWin: c}
+	go func() {
+		ww.ExecGet("")
+		runEvents(c.w, ww)
+	}()
+	return nil
+}
+
+func (ww *worktreeWin) ExecGet(cmd string) {
+	wts, err := ww.repo.worktrees()
+	if err != nil {
+		fmt.Fprintln(&ww.buf, err)
+		ww.flush()
+		return
+	}
+	for _, wt := range wts {
+		desc := wt.branch
+		switch {
+		case wt.bare:
+			desc = "(bare)"
+		case desc == "" && len(wt.head) > 8:
+			desc = "detached at " + wt.head[:8]
+		}
+		if wt.locked {
+			desc += ", locked"
+		}
+		if wt.prunable {
+			desc += ", prunable"
+		}
+		fmt.Fprintf(&ww.buf, "%s\t%s\n", wt.path, desc)
+		if !wt.bare {
+			fmt.Fprintf(&ww.buf, "\tOpen %s\tWorktreeRemove %s\n", wt.path, wt.path)
+		}
+	}
+	ww.flush()
+}
+
+// open a +git window for a worktree
+func (ww *worktreeWin) ExecOpen(path string) error {
+	if path == "" {
+		return errors.New("usage: Open /path/to/worktree")
+	}
+	return openRepo(filepath.Clean(path))
+}
+
+func (ww *worktreeWin) ExecWorktreeAdd(branch string) error {
+	return ww.repo.command(func() error {
+		ww.repo.ExecWorktreeAdd(branch)
+		ww.ExecGet("")
+		return nil
+	})
+}
+
+func (ww *worktreeWin) ExecWorktreeRemove(path string) error {
+	return ww.repo.command(func() error {
+		ww.repo.ExecWorktreeRemove(path)
+		ww.ExecGet("")
+		return nil
+	})
+}
+
+// WorktreeAdd branch checks out branch in a new worktree next to this one,
+// creating the branch if it doesn't exist yet, and opens a +git window for it
+func (h *handler) ExecWorktreeAdd(cmd string) {
+	branch := strings.TrimSpace(cmd)
+	if branch == "" {
+		fmt.Fprintln(&h.buf, "usage: WorktreeAdd branch")
+		h.flush()
+		return
+	}
+	dir := filepath.Join(filepath.Dir(h.path), filepath.Base(h.path)+"-"+strings.ReplaceAll(branch, "/", "-"))
+	args := []string{"worktree", "add"}
+	if !h.refExists(branch) {
+		args = append(args, "-b", branch, dir)
+	} else {
+		args = append(args, dir, branch)
+	}
+	if h.git(args...) != nil {
+		h.flush()
+		return
+	}
+	if err := openRepo(dir); err != nil {
+		fmt.Fprintf(&h.buf, "error opening worktree %s: %v\n", dir, err)
+	}
+	h.ExecGet("")
+}
+
+// whether name resolves to a commit, or is a branch on some remote that
+// `git worktree add` will create a tracking branch for
+func (h *handler) refExists(name string) bool {
+	var out bytes.Buffer
+	if runGit(h.path, nil, &out, "rev-parse", "--verify", "--quiet", name+"^{commit}") == nil {
+		return true
+	}
+	out.Reset()
+	runGit(h.path, nil, &out, "for-each-ref", "--format=%(refname)", "refs/remotes/*/"+name)
+	return strings.TrimSpace(out.String()) != ""
+}
+
+// WorktreeRemove path removes a worktree and closes its +git window
+func (h *handler) ExecWorktreeRemove(cmd string) {
+	path := filepath.Clean(strings.TrimSpace(cmd))
+	if path == "." || path == h.path {
+		fmt.Fprintln(&h.buf, "usage: WorktreeRemove /path/to/other/worktree")
+		h.flush()
+		return
+	}
+	if h.git("worktree", "remove", path) != nil {
+		h.flush()
+		return
+	}
+	if wh := findHandler(path); wh != nil {
+		wh.repoWindows("del")
+		wh.w.Del(true)
+	}
+	h.ExecGet("")
+}